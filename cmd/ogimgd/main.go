@@ -1,32 +1,100 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/nDmitry/ogimgd/internal/logging"
 	"github.com/nDmitry/ogimgd/internal/preview"
 	"github.com/nDmitry/ogimgd/internal/server"
+	"github.com/nDmitry/ogimgd/internal/tracing"
 )
 
 func main() {
 	port := 8201
+	logFormat := logging.FormatJSON
+	logLevel := "info"
 
-	if os.Getenv("PORT") != "" {
-		var err error
+	if os.Getenv("LOG_FORMAT") != "" {
+		logFormat = os.Getenv("LOG_FORMAT")
+	}
+
+	if os.Getenv("LOG_LEVEL") != "" {
+		logLevel = os.Getenv("LOG_LEVEL")
+	}
+
+	logger, err := logging.New(os.Stderr, logFormat, logLevel)
+
+	if err != nil {
+		log.Fatalf("could not configure logging: %s\n", err)
+	}
+
+	slog.SetDefault(logger)
+
+	tracesExporter := tracing.ExporterNone
+	tracesOut := os.Stdout
+
+	if os.Getenv("OTEL_TRACES_EXPORTER") != "" {
+		tracesExporter = os.Getenv("OTEL_TRACES_EXPORTER")
+	}
+
+	if os.Getenv("OTEL_TRACES_FILE") != "" {
+		if tracesOut, err = os.Create(os.Getenv("OTEL_TRACES_FILE")); err != nil {
+			log.Fatalf("could not create the traces file: %s\n", err)
+		}
+
+		defer tracesOut.Close()
+	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracesExporter, tracesOut)
+
+	if err != nil {
+		log.Fatalf("could not configure tracing: %s\n", err)
+	}
+
+	defer shutdownTracing(context.Background())
+
+	if os.Getenv("PORT") != "" {
 		if port, err = strconv.Atoi(os.Getenv("PORT")); err != nil {
 			log.Fatalf("could not parse the app port: %s\n", os.Getenv("PORT"))
 		}
 	}
 
-	vips.LoggingSettings(nil, vips.LogLevelError)
+	vips.LoggingSettings(func(domain string, _ vips.LogLevel, message string) {
+		slog.Error(message, "domain", domain)
+	}, vips.LogLevelError)
 
 	vips.Startup(nil)
 	defer vips.Shutdown()
 
+	if os.Getenv("FONTS_DIR") != "" {
+		found, err := preview.ScanFonts(os.Getenv("FONTS_DIR"))
+
+		if err != nil {
+			log.Fatalf("could not scan the fonts: %s\n", err)
+		}
+
+		slog.Info("scanned the fonts directory", "dir", os.Getenv("FONTS_DIR"), "fonts", found)
+
+		manifest := filepath.Join(os.Getenv("FONTS_DIR"), preview.FontManifest)
+
+		if _, err := os.Stat(manifest); err == nil {
+			registered, err := preview.LoadFontManifest(manifest)
+
+			if err != nil {
+				log.Fatalf("could not load the font manifest: %s\n", err)
+			}
+
+			slog.Info("loaded the font manifest", "path", manifest, "fonts", registered)
+		}
+	}
+
 	p := preview.New()
 
-	server.Run(port, p)
+	server.Run(port, p, os.Getenv("DEBUG_KEY"))
 }
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Supported log formats
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+type attrsKey struct{}
+
+// New returns a leveled structured logger writing to w in the given format (json or logfmt).
+// Every record logged with a context also carries the attributes attached to that context using With.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("could not parse the log level: %s: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.New(&contextHandler{slog.NewJSONHandler(w, opts)}), nil
+	case FormatLogfmt:
+		return slog.New(&contextHandler{slog.NewTextHandler(w, opts)}), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+}
+
+// With returns a copy of the context carrying the attributes (key-value pairs or slog.Attr)
+// in addition to the ones it already has.
+func With(ctx context.Context, args ...interface{}) context.Context {
+	parent, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	r := slog.Record{}
+
+	r.Add(args...)
+
+	attrs := make([]slog.Attr, 0, len(parent)+r.NumAttrs())
+	attrs = append(attrs, parent...)
+
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// contextHandler adds the attributes attached to the record context to the record itself.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWith(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := New(buf, FormatJSON, "info")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := With(context.Background(), "request_id", "abc")
+	ctx = With(ctx, "asset", "logo")
+
+	logger.DebugContext(ctx, "filtered out")
+	logger.InfoContext(ctx, "resized an image", "to", "64x64")
+
+	rec := map[string]interface{}{}
+
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"level":      "INFO",
+		"msg":        "resized an image",
+		"to":         "64x64",
+		"request_id": "abc",
+		"asset":      "logo",
+	}
+
+	for key, value := range expected {
+		if rec[key] != value {
+			t.Errorf("unexpected %s, expected: %v, actual: %v", key, value, rec[key])
+		}
+	}
+}
+
+func TestNew_Bad(t *testing.T) {
+	if _, err := New(new(bytes.Buffer), "xml", "info"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	if _, err := New(new(bytes.Buffer), FormatLogfmt, "loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
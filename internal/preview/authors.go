@@ -0,0 +1,145 @@
+package preview
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxAuthors is the max number of the authors of a preview
+	MaxAuthors = 10
+	// maxStacked is the max number of the avatars in the stack, the byline still names or counts all the authors
+	maxStacked = 5
+	// stackOverlap is the share of the avatar size covered by the previous one in the stack
+	stackOverlap = 0.3
+)
+
+// Author is one of the authors of the post: the name and the avatar.
+type Author struct {
+	Name string `json:"name"`
+	// An URL to the avatar pic
+	AvaURL string `json:"avaURL"`
+	// Generate the avatar from the name instead of fetching AvaURL
+	AvaGenerator AvaGenerator `json:"avaGenerator"`
+}
+
+// authors returns the authors of the preview: Options.Authors, or the single one of Author and AvaURL.
+func (p *Preview) authors() []Author {
+	if len(p.opts.Authors) > 0 {
+		return p.opts.Authors
+	}
+
+	if p.opts.Author == "" {
+		return nil
+	}
+
+	return []Author{{Name: p.opts.Author, AvaURL: p.opts.AvaURL, AvaGenerator: p.opts.AvaGenerator}}
+}
+
+// stacked returns the authors with avatars in the order of the stack, up to maxStacked.
+func (p *Preview) stacked() []Author {
+	if p.opts.AvaD <= 0 {
+		return nil
+	}
+
+	var authors []Author
+
+	for _, a := range p.authors() {
+		if (a.AvaURL != "" || a.AvaGenerator != AvaFetched) && len(authors) < maxStacked {
+			authors = append(authors, a)
+		}
+	}
+
+	return authors
+}
+
+// avatarKey returns the asset key of the avatar of the i-th author, the first one is just the avatar.
+func avatarKey(i int) string {
+	if i == 0 {
+		return avaKey
+	}
+
+	return fmt.Sprintf("%s%d", avaKey, i+1)
+}
+
+// avatarCenter returns the center of the i-th avatar of the stack, it stays in place whatever the border width is.
+func (p *Preview) avatarCenter(i int) (float64, float64) {
+	step := float64(p.opts.AvaD) * (1 - stackOverlap)
+
+	return padding + float64(p.opts.AvaD+border)/2 + float64(i)*step, padding + float64(p.opts.AvaD+border)/2
+}
+
+// authorX returns the left edge of the byline box, next to the avatar stack.
+func (p *Preview) authorX() float64 {
+	n := len(p.stacked())
+
+	if n == 0 {
+		return padding
+	}
+
+	return padding + float64(p.opts.AvaD)*(1+float64(n-1)*(1-stackOverlap)) + padding/2
+}
+
+// authorNames returns the names of all the authors joined.
+func (p *Preview) authorNames() string {
+	authors := p.authors()
+	names := make([]string, len(authors))
+
+	for i, a := range authors {
+		names[i] = a.Name
+	}
+
+	return byline(names, len(names))
+}
+
+// fitByline returns the byline of the authors in the author typography that fits the width with the current font
+// face: it names as many authors as fit and counts the rest. The first name is cut off with "…" when even it
+// doesn't fit.
+func (p *Preview) fitByline(width float64) string {
+	authors := p.authors()
+	names := make([]string, len(authors))
+
+	for i, a := range authors {
+		names[i] = a.Name
+	}
+
+	text := func(s string) string {
+		return p.opts.AuthorTypography.transform(plain(s), p.opts.Lang).text
+	}
+
+	for shown := len(names); shown > 0; shown-- {
+		if s := text(byline(names, shown)); p.measure(s) <= width {
+			return s
+		}
+	}
+
+	name, others := text(names[0]), text(strings.TrimPrefix(byline(names, 1), names[0]))
+
+	for name != "" && p.measure(name+ellipsis+others) > width {
+		// cut the last grapheme cluster off
+		clusters := graphemes(name)
+		name = strings.TrimRightFunc(name[:len(name)-len(clusters[len(clusters)-1])], unicode.IsSpace)
+	}
+
+	return name + ellipsis + others
+}
+
+// byline joins the first shown names and counts the rest, e.g. "Alice, Bob and 2 others" or "Alice and Bob".
+func byline(names []string, shown int) string {
+	if shown >= len(names) {
+		if len(names) < 2 {
+			return strings.Join(names, "")
+		}
+
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+
+	others := "others"
+
+	if len(names)-shown == 1 {
+		others = "other"
+	}
+
+	return fmt.Sprintf("%s and %d %s", strings.Join(names[:shown], ", "), len(names)-shown, others)
+}
@@ -0,0 +1,90 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestByline(t *testing.T) {
+	names := []string{"Alice", "Bob", "Carol", "Dave"}
+	testCases := []struct {
+		name     string
+		names    []string
+		shown    int
+		expected string
+	}{{
+		name:     "one author",
+		names:    names[:1],
+		shown:    1,
+		expected: "Alice",
+	}, {
+		name:     "two authors",
+		names:    names[:2],
+		shown:    2,
+		expected: "Alice and Bob",
+	}, {
+		name:     "all shown",
+		names:    names,
+		shown:    4,
+		expected: "Alice, Bob, Carol and Dave",
+	}, {
+		name:     "others",
+		names:    names,
+		shown:    2,
+		expected: "Alice, Bob and 2 others",
+	}, {
+		name:     "one other",
+		names:    names[:2],
+		shown:    1,
+		expected: "Alice and 1 other",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := byline(tt.names, tt.shown); actual != tt.expected {
+				t.Errorf("%q of %d: expected %q, got %q", tt.names, tt.shown, tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFitByline(t *testing.T) {
+	p := newTestPreview(t, 20)
+	p.opts.Authors = []Author{{Name: "Alice"}, {Name: "Bob"}, {Name: "Carol"}, {Name: "Dave"}}
+
+	testCases := []struct {
+		name     string
+		width    float64
+		expected string
+	}{{
+		name:     "all fit",
+		width:    p.measure("Alice, Bob, Carol and Dave"),
+		expected: "Alice, Bob, Carol and Dave",
+	}, {
+		name:     "two others",
+		width:    p.measure("Alice, Bob and 2 others"),
+		expected: "Alice, Bob and 2 others",
+	}, {
+		name:     "three others",
+		width:    p.measure("Alice and 3 others"),
+		expected: "Alice and 3 others",
+	}, {
+		name:     "name cut off",
+		width:    p.measure("Ali… and 3 others"),
+		expected: "Ali… and 3 others",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := p.fitByline(tt.width); actual != tt.expected {
+				t.Errorf("%.0fpx: expected %q, got %q", tt.width, tt.expected, actual)
+			}
+		})
+	}
+
+	p.opts.AuthorTypography.Uppercase = true
+
+	if actual := p.fitByline(1000); actual != strings.ToUpper("Alice, Bob, Carol and Dave") {
+		t.Errorf("expected the uppercase byline, got %q", actual)
+	}
+}
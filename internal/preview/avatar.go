@@ -0,0 +1,157 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// AvaShape is a shape the avatar image is cut out with.
+type AvaShape string
+
+// Avatar shapes, the zero value is the circle
+const (
+	AvaCircle   AvaShape = ""
+	AvaSquare   AvaShape = "square"
+	AvaRounded  AvaShape = "rounded"
+	AvaSquircle AvaShape = "squircle"
+	AvaHexagon  AvaShape = "hexagon"
+)
+
+const (
+	// AvaBorder is the default width of the avatar border
+	AvaBorder = 4.0
+	// roundedRadius is the corner radius of the rounded avatar relative to its size
+	roundedRadius = 0.2
+	// squircleExponent is the exponent of the superellipse the squircle avatar is
+	squircleExponent = 4.0
+	// squircleSegments is the number of the segments the squircle outline is approximated with
+	squircleSegments = 96
+)
+
+// Avatar defines the shape, the border and the shadow of the avatar. The zero value draws a circle without a border.
+type Avatar struct {
+	Shape AvaShape `json:"shape"`
+	// Border width in pixels, 0 draws none
+	Border float64 `json:"border"`
+	// Border color in HEX, white by default
+	BorderColor string `json:"borderColor"`
+	// Shadow of the avatar with its border
+	Shadow *Shadow `json:"shadow,omitempty"`
+}
+
+// ParseAvaShape parses an avatar shape: circle, square, rounded, squircle or hexagon.
+func ParseAvaShape(s string) (AvaShape, error) {
+	switch shape := AvaShape(strings.ToLower(s)); shape {
+	case AvaSquare, AvaRounded, AvaSquircle, AvaHexagon:
+		return shape, nil
+	case "circle":
+		return AvaCircle, nil
+	default:
+		return AvaCircle, fmt.Errorf("unknown avatar shape %q", s)
+	}
+}
+
+// drawAvatarImage draws the shadow, the border and the image of the avatar centered at x, y. The image is cut out
+// with an anti-aliased mask of the shape.
+func (p *Preview) drawAvatarImage(img image.Image, x, y float64) {
+	ava := p.opts.Avatar
+	size := float64(img.Bounds().Dx())
+	// the masks leave room for the border and the blur of the shadow
+	spread := ava.Border + 1
+
+	if ava.Shadow != nil {
+		spread += ava.Shadow.Blur
+	}
+
+	r := image.Rect(int(x-size/2-spread), int(y-size/2-spread), int(math.Ceil(x+size/2+spread)), int(math.Ceil(y+size/2+spread)))
+	outline := shapeMask(ava.Shape, r, x, y, size, ava.Border)
+
+	if ava.Shadow != nil {
+		c, _ := ParseColor(ava.Shadow.Color)
+
+		p.fillMask(blur(outline, ava.Shadow.Blur), c, image.Pt(int(math.Round(ava.Shadow.X)), int(math.Round(ava.Shadow.Y))))
+	}
+
+	if ava.Border > 0 {
+		c, err := ParseColor(ava.BorderColor)
+
+		if err != nil {
+			c, _ = ParseColor(avatarBorderColor)
+		}
+
+		p.fillMask(outline, c, image.Point{})
+	}
+
+	dst, ok := p.ctx.Image().(draw.Image)
+
+	if !ok {
+		return
+	}
+
+	// placed like gg.Context.DrawImageAnchored does
+	at := image.Pt(int(x)-img.Bounds().Dx()/2, int(y)-img.Bounds().Dy()/2)
+	mask := shapeMask(ava.Shape, r, x, y, size, 0)
+
+	draw.DrawMask(dst, img.Bounds().Sub(img.Bounds().Min).Add(at), img, img.Bounds().Min, mask, at, draw.Over)
+}
+
+// shapeMask returns the anti-aliased coverage of the shape of the size centered at x, y within the rectangle.
+// The outline is moved out by the offset, e.g. to get the one of the border.
+func shapeMask(shape AvaShape, r image.Rectangle, x, y, size, offset float64) *image.Alpha {
+	dc := gg.NewContext(r.Dx(), r.Dy())
+
+	dc.Translate(-float64(r.Min.X), -float64(r.Min.Y))
+	shapePath(dc, shape, x, y, size, offset)
+	dc.SetColor(color.White)
+	dc.Fill()
+
+	mask := image.NewAlpha(r)
+
+	draw.Draw(mask, r, dc.Image(), image.Point{}, draw.Src)
+
+	return mask
+}
+
+// shapePath adds the outline of the shape of the size centered at x, y moved out by the offset to the path.
+func shapePath(dc *gg.Context, shape AvaShape, x, y, size, offset float64) {
+	half := size/2 + offset
+
+	switch shape {
+	case AvaSquare:
+		dc.DrawRectangle(x-half, y-half, half*2, half*2)
+	case AvaRounded:
+		dc.DrawRoundedRectangle(x-half, y-half, half*2, half*2, size*roundedRadius+offset)
+	case AvaSquircle:
+		// the superellipse |x|^n + |y|^n = half^n
+		for i := 0; i < squircleSegments; i++ {
+			a := 2 * math.Pi * float64(i) / squircleSegments
+			cos, sin := math.Cos(a), math.Sin(a)
+
+			dc.LineTo(
+				x+half*math.Copysign(math.Pow(math.Abs(cos), 2/squircleExponent), cos),
+				y+half*math.Copysign(math.Pow(math.Abs(sin), 2/squircleExponent), sin),
+			)
+		}
+
+		dc.ClosePath()
+	case AvaHexagon:
+		// pointy top, moving the sides out by the offset moves the corners out by offset / cos 30°
+		circumradius := size/2 + offset/math.Cos(math.Pi/6)
+
+		for i := 0; i < 6; i++ {
+			a := math.Pi/3*float64(i) - math.Pi/2
+
+			dc.LineTo(x+circumradius*math.Cos(a), y+circumradius*math.Sin(a))
+		}
+
+		dc.ClosePath()
+	default:
+		dc.DrawCircle(x, y, half)
+	}
+}
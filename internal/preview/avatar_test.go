@@ -0,0 +1,76 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestDrawAvatarImage(t *testing.T) {
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	white, black := color.NRGBA{R: 255, G: 255, B: 255, A: 255}, color.NRGBA{A: 255}
+	// the 64px avatar is drawn at the center of the canvas, it spans from 68 to 132
+	ava := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(ava, ava.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+
+	type pixel struct {
+		x, y     int
+		expected color.NRGBA
+	}
+
+	testCases := []struct {
+		name   string
+		avatar Avatar
+		pixels []pixel
+	}{{
+		name:   "circle",
+		avatar: Avatar{},
+		pixels: []pixel{{100, 100, red}, {69, 69, white}, {74, 74, white}},
+	}, {
+		name:   "square",
+		avatar: Avatar{Shape: AvaSquare},
+		pixels: []pixel{{69, 69, red}, {66, 66, white}},
+	}, {
+		name:   "squircle",
+		avatar: Avatar{Shape: AvaSquircle},
+		pixels: []pixel{{74, 74, red}, {69, 69, white}},
+	}, {
+		name:   "hexagon",
+		avatar: Avatar{Shape: AvaHexagon},
+		pixels: []pixel{{100, 70, red}, {70, 100, white}},
+	}, {
+		name:   "border",
+		avatar: Avatar{Border: 4, BorderColor: "#0000FF"},
+		pixels: []pixel{{100, 66, blue}, {100, 62, white}, {100, 100, red}},
+	}, {
+		name:   "shadow",
+		avatar: Avatar{Shape: AvaSquare, Shadow: &Shadow{Y: 10, Color: "#000000"}},
+		pixels: []pixel{{100, 136, black}, {100, 145, white}},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preview{opts: &Options{Avatar: tt.avatar}, ctx: gg.NewContext(200, 200)}
+
+			p.ctx.SetColor(color.White)
+			p.ctx.Clear()
+			p.drawAvatarImage(ava, 100, 100)
+
+			for _, px := range tt.pixels {
+				if c := toNRGBA(p.ctx.Image().At(px.x, px.y)); !similar(c, px.expected) {
+					t.Errorf("%d,%d: expected %v, got %v", px.x, px.y, px.expected, c)
+				}
+			}
+
+			// the edge at 45° is anti-aliased
+			if tt.avatar == (Avatar{}) {
+				if g := toNRGBA(p.ctx.Image().At(122, 122)).G; g < 20 || g > 235 {
+					t.Errorf("expected the edge to be partly covered, got %d", g)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Fit is a way the background image is fitted to the canvas.
+type Fit string
+
+// Fit modes, the zero value covers the canvas cropping the image to its area of interest or the focal point
+const (
+	FitCover   Fit = ""
+	FitContain Fit = "contain"
+	FitFill    Fit = "fill"
+	FitTile    Fit = "tile"
+)
+
+// Background filter limits
+const (
+	MaxBgBlur       = 100.0
+	MaxBgBrightness = 3.0
+)
+
+// gravities are the focal points of the crop gravities
+var gravities = map[string]Focus{
+	"center":       {X: 0.5, Y: 0.5},
+	"top":          {X: 0.5, Y: 0},
+	"bottom":       {X: 0.5, Y: 1},
+	"left":         {X: 0, Y: 0.5},
+	"right":        {X: 1, Y: 0.5},
+	"top-left":     {X: 0, Y: 0},
+	"top-right":    {X: 1, Y: 0},
+	"bottom-left":  {X: 0, Y: 1},
+	"bottom-right": {X: 1, Y: 1},
+}
+
+// Background defines how the background image is fitted to the canvas and filtered. Zero values keep
+// the smart-cropped image as is.
+type Background struct {
+	Fit Fit `json:"fit"`
+	// Focal point of the cover crop, nil crops to the area of interest
+	Focus *Focus `json:"focus,omitempty"`
+	// Crop to the faces found in the image when there's no focal point
+	Faces bool `json:"faces"`
+	// Gaussian blur sigma in pixels
+	Blur      float64 `json:"blur"`
+	Grayscale bool    `json:"grayscale"`
+	// Shadows and highlights colors of the duotone, it maps the image luminance to a gradient between them
+	Duotone *Duotone `json:"duotone,omitempty"`
+	// Brightness multiplier, 1 and 0 keep it as is
+	Brightness float64 `json:"brightness"`
+}
+
+// Focus is a point of an image as fractions of its width and height, 0,0 is the top left corner.
+type Focus struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Duotone is a pair of HEX colors the image luminance is mapped to.
+type Duotone struct {
+	Dark  string `json:"dark"`
+	Light string `json:"light"`
+}
+
+// ParseFit parses a background fit mode: cover, contain, fill or tile.
+func ParseFit(s string) (Fit, error) {
+	switch fit := Fit(strings.ToLower(s)); fit {
+	case FitContain, FitFill, FitTile:
+		return fit, nil
+	case "cover":
+		return FitCover, nil
+	default:
+		return FitCover, fmt.Errorf("unknown fit mode %q", s)
+	}
+}
+
+// ParseFocus parses a focal point: "x,y" fractions or a gravity, e.g. center, top or bottom-right.
+func ParseFocus(s string) (*Focus, error) {
+	if focus, ok := gravities[strings.ToLower(s)]; ok {
+		return &focus, nil
+	}
+
+	parts := strings.Split(s, ",")
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected x,y or a gravity, got %q", s)
+	}
+
+	focus := &Focus{}
+
+	for i, v := range []*float64{&focus.X, &focus.Y} {
+		var err error
+
+		if *v, err = ParseFinite(strings.TrimSpace(parts[i])); err != nil {
+			return nil, fmt.Errorf("could not parse %q: %w", parts[i], err)
+		}
+
+		if *v < 0 || *v > 1 {
+			return nil, fmt.Errorf("the focal point %q is out of the image", s)
+		}
+	}
+
+	return focus, nil
+}
+
+// ParseDuotone parses a duotone: "dark,light" HEX colors.
+func ParseDuotone(s string) (*Duotone, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected dark,light colors, got %q", s)
+	}
+
+	duotone := &Duotone{Dark: strings.TrimSpace(parts[0]), Light: strings.TrimSpace(parts[1])}
+
+	for _, c := range []string{duotone.Dark, duotone.Light} {
+		if _, err := ParseColor(c); err != nil {
+			return nil, fmt.Errorf("invalid duotone color %q", c)
+		}
+	}
+
+	return duotone, nil
+}
+
+// isZero reports whether the background image is used as is.
+func (b Background) isZero() bool {
+	return b.Fit == FitCover && b.Focus == nil && !b.Faces && b.Blur == 0 && !b.Grayscale && b.Duotone == nil &&
+		(b.Brightness == 0 || b.Brightness == 1)
+}
+
+// fitImage fits the image to the size with the fit mode of the background and applies its filters.
+// The letterbox of the contained image is black.
+func fitImage(ctx context.Context, buf []byte, w, h int, bg Background) (_ []byte, err error) {
+	startedAt := time.Now()
+	ctx, span := tracing.Start(
+		ctx, "vips.Fit",
+		attribute.String("fit", string(bg.Fit)),
+		attribute.String("to", fmt.Sprintf("%dx%d", w, h)),
+	)
+
+	defer func() { tracing.End(span, err) }()
+
+	vipsImg, err := vips.NewImageFromBuffer(buf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer vipsImg.Close()
+
+	from := fmt.Sprintf("%dx%d", vipsImg.Width(), vipsImg.Height())
+
+	if err = fit(vipsImg, w, h, bg); err != nil {
+		return nil, fmt.Errorf("could not fit the image: %w", err)
+	}
+
+	if err = filter(vipsImg, bg); err != nil {
+		return nil, fmt.Errorf("could not filter the image: %w", err)
+	}
+
+	buf, _, err = vipsImg.Export(vips.NewDefaultExportParams())
+
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(
+		ctx, "fitted an image",
+		"from", from,
+		"to", fmt.Sprintf("%dx%d", w, h),
+		"fit", bg.Fit,
+		"took", time.Since(startedAt),
+	)
+
+	return buf, nil
+}
+
+// fit resizes the image to the size with the fit mode.
+func fit(img *vips.ImageRef, w, h int, bg Background) error {
+	scaleW, scaleH := float64(w)/float64(img.Width()), float64(h)/float64(img.Height())
+
+	switch bg.Fit {
+	case FitContain:
+		if err := img.Resize(math.Min(scaleW, scaleH), vips.KernelAuto); err != nil {
+			return err
+		}
+
+		return img.Embed((w-img.Width())/2, (h-img.Height())/2, w, h, vips.ExtendBlack)
+	case FitFill:
+		return img.ResizeWithVScale(scaleW, scaleH, vips.KernelAuto)
+	case FitTile:
+		across := int(math.Ceil(float64(w) / float64(img.Width())))
+		down := int(math.Ceil(float64(h) / float64(img.Height())))
+
+		if err := img.Replicate(across, down); err != nil {
+			return err
+		}
+
+		return img.ExtractArea(0, 0, w, h)
+	}
+
+	if bg.Focus == nil {
+		return img.Thumbnail(w, h, vips.InterestingAttention)
+	}
+
+	return cover(img, w, h, *bg.Focus)
+}
+
+// cover resizes the image to cover the size and crops it around the focal point.
+func cover(img *vips.ImageRef, w, h int, focus Focus) error {
+	scaleW, scaleH := float64(w)/float64(img.Width()), float64(h)/float64(img.Height())
+
+	if err := img.Resize(math.Max(scaleW, scaleH), vips.KernelAuto); err != nil {
+		return err
+	}
+
+	// the crop is centered at the focal point as far as the image edges allow
+	w, h = min(w, img.Width()), min(h, img.Height())
+	left := int(math.Round(focus.X*float64(img.Width()) - float64(w)/2))
+	top := int(math.Round(focus.Y*float64(img.Height()) - float64(h)/2))
+
+	return img.ExtractArea(max(0, min(left, img.Width()-w)), max(0, min(top, img.Height()-h)), w, h)
+}
+
+// filter applies the blur, the grayscale or the duotone, and the brightness filters to the image.
+func filter(img *vips.ImageRef, bg Background) error {
+	if bg.Blur > 0 {
+		if err := img.GaussianBlur(bg.Blur); err != nil {
+			return err
+		}
+	}
+
+	if bg.Grayscale || bg.Duotone != nil {
+		if err := img.ToColorSpace(vips.InterpretationBW); err != nil {
+			return err
+		}
+
+		if err := img.ToColorSpace(vips.InterpretationSRGB); err != nil {
+			return err
+		}
+	}
+
+	if bg.Duotone != nil {
+		dark, _ := ParseColor(bg.Duotone.Dark)
+		light, _ := ParseColor(bg.Duotone.Light)
+		d, l := toNRGBA(dark), toNRGBA(light)
+		a, b := make([]float64, 3), make([]float64, 3)
+
+		// each gray level v becomes dark + (light - dark) * v / 255
+		for i, ch := range [][2]uint8{{d.R, l.R}, {d.G, l.G}, {d.B, l.B}} {
+			a[i], b[i] = (float64(ch[1])-float64(ch[0]))/255, float64(ch[0])
+		}
+
+		if err := linearBands(img, a, b); err != nil {
+			return err
+		}
+	}
+
+	if bg.Brightness > 0 && bg.Brightness != 1 {
+		return linearBands(img, []float64{bg.Brightness, bg.Brightness, bg.Brightness}, []float64{0, 0, 0})
+	}
+
+	return nil
+}
+
+// linearBands transforms the color bands of the image as v * a + b keeping the alpha band.
+func linearBands(img *vips.ImageRef, a, b []float64) error {
+	if img.HasAlpha() {
+		a, b = append(a, 1), append(b, 0)
+	}
+
+	return img.Linear(a, b)
+}
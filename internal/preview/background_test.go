@@ -0,0 +1,159 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestParseFocus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected *Focus
+	}{{
+		name:     "gravity",
+		s:        "bottom-right",
+		expected: &Focus{X: 1, Y: 1},
+	}, {
+		name:     "capitalized gravity",
+		s:        "Top",
+		expected: &Focus{X: 0.5, Y: 0},
+	}, {
+		name:     "coordinates",
+		s:        "0.25, 0.75",
+		expected: &Focus{X: 0.25, Y: 0.75},
+	}, {
+		name:     "single coordinate",
+		s:        "0.5",
+		expected: nil,
+	}, {
+		name:     "out of the image",
+		s:        "0.5,1.5",
+		expected: nil,
+	}, {
+		name:     "NaN coordinate",
+		s:        "NaN,0.5",
+		expected: nil,
+	}, {
+		name:     "unknown gravity",
+		s:        "north",
+		expected: nil,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := ParseFocus(tt.s)
+
+			if !reflect.DeepEqual(actual, tt.expected) || (err == nil) != (tt.expected != nil) {
+				t.Errorf("%q: expected %+v, got %+v (%v)", tt.s, tt.expected, actual, err)
+			}
+		})
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	// the left half is red and the right one is blue
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			if x < 100 {
+				src.SetNRGBA(x, y, red)
+			} else {
+				src.SetNRGBA(x, y, blue)
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	type pixel struct {
+		x, y     int
+		expected color.NRGBA
+	}
+
+	testCases := []struct {
+		name   string
+		bg     Background
+		w, h   int
+		pixels []pixel
+	}{{
+		name:   "cover at the focal point",
+		bg:     Background{Focus: &Focus{X: 1, Y: 0.5}},
+		w:      50,
+		h:      50,
+		pixels: []pixel{{5, 25, blue}, {45, 25, blue}},
+	}, {
+		name:   "contain",
+		bg:     Background{Fit: FitContain},
+		w:      100,
+		h:      100,
+		pixels: []pixel{{50, 5, color.NRGBA{A: 255}}, {10, 50, red}, {90, 50, blue}},
+	}, {
+		name:   "fill",
+		bg:     Background{Fit: FitFill},
+		w:      50,
+		h:      100,
+		pixels: []pixel{{10, 50, red}, {40, 50, blue}},
+	}, {
+		name:   "tile",
+		bg:     Background{Fit: FitTile},
+		w:      300,
+		h:      50,
+		pixels: []pixel{{250, 25, red}, {50, 25, red}, {150, 25, blue}},
+	}, {
+		// the red is about 54 of 255 gray, it's mapped to 54 of the way from green to white and halved
+		name:   "duotone",
+		bg:     Background{Focus: &Focus{}, Duotone: &Duotone{Dark: "#00FF00", Light: "#FFFFFF"}, Brightness: 0.5},
+		w:      50,
+		h:      100,
+		pixels: []pixel{{25, 50, color.NRGBA{R: 27, G: 128, B: 27, A: 255}}},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fitted, err := fitImage(context.Background(), buf.Bytes(), tt.w, tt.h, tt.bg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img, _, err := image.Decode(bytes.NewReader(fitted))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+				t.Fatalf("expected %dx%d, got %v", tt.w, tt.h, b)
+			}
+
+			for _, px := range tt.pixels {
+				if actual := toNRGBA(img.At(px.x, px.y)); !similar(actual, px.expected) {
+					t.Errorf("expected %v at %d,%d, got %v", px.expected, px.x, px.y, actual)
+				}
+			}
+		})
+	}
+}
+
+// similar reports whether the colors differ by a few levels of each channel at most, as lossy encodings do.
+func similar(a, b color.NRGBA) bool {
+	for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		if d < -12 || d > 12 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,288 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// ContrastAA is the minimal WCAG contrast ratio of normal text
+	ContrastAA = 4.5
+	// MaxContrast is the contrast ratio of black and white
+	MaxContrast = 21.0
+	// contrastPercentile is the share of the background pixels under a text box the contrast is met for,
+	// so that a few specks of the opposite lightness don't make the overlay opaque
+	contrastPercentile = 0.95
+	// luminanceBins is the number of the luminance histogram bins
+	luminanceBins = 1024
+	// opacitySteps is the number of the binary search steps of the overlay opacity
+	opacitySteps = 12
+)
+
+// theme is the overlay color and the default text colors drawn over it.
+type theme struct {
+	name    string
+	overlay color.NRGBA
+	title   color.Color
+	author  color.Color
+}
+
+// Themes, the dark one is the default: white text over a black overlay
+var (
+	darkTheme  = theme{name: "dark", overlay: color.NRGBA{A: 255}, title: titleColor, author: authorColor}
+	lightTheme = theme{
+		name:    "light",
+		overlay: color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		title:   color.Black,
+		author:  color.NRGBA{A: 204},
+	}
+)
+
+// textBox is a part of the canvas a text element is drawn in and the text color.
+type textBox struct {
+	element string
+	rect    image.Rectangle
+	color   color.Color
+}
+
+// luminanceRange is the relative luminance of the darkest and the lightest background pixels under a text box
+// except for the outliers.
+type luminanceRange struct {
+	dark, light float64
+}
+
+// autoContrast picks the theme and the lowest overlay opacity at which each text element has at least
+// the target contrast ratio with the background under it. The canvas must have only the background drawn.
+// Gradients are measured at the most transparent point of each text element.
+// When neither theme reaches the target, the one with the higher contrast is used with an opaque overlay.
+func (p *Preview) autoContrast() (theme, float64, *ContrastReport) {
+	canvas := p.ctx.Image()
+	var best *ContrastReport
+	chosen := darkTheme
+
+	for _, t := range []theme{darkTheme, lightTheme} {
+		t.overlay = p.overlayColor(t)
+		boxes := p.textBoxes(t)
+		ranges := make([]luminanceRange, len(boxes))
+		coverages := make([]float64, len(boxes))
+
+		for i, box := range boxes {
+			ranges[i] = measureLuminance(canvas, box.rect)
+			coverages[i] = p.overlayCoverage(box.rect)
+		}
+
+		opacity := minOpacity(t, boxes, ranges, coverages, p.opts.Contrast)
+		report := &ContrastReport{Target: p.opts.Contrast, Theme: t.name, Opacity: opacity, Ratio: MaxContrast}
+
+		for i, box := range boxes {
+			ratio := boxContrast(t, box, ranges[i], opacity*coverages[i])
+			report.Ratio = math.Min(report.Ratio, ratio)
+			report.Elements = append(report.Elements, ElementContrast{
+				Element: box.element,
+				Dark:    ranges[i].dark,
+				Light:   ranges[i].light,
+				Ratio:   ratio,
+			})
+		}
+
+		if best == nil || better(report, best) {
+			best, chosen = report, t
+		}
+	}
+
+	return chosen, best.Opacity, best
+}
+
+// better reports whether the contrast a is better than b: it meets the target with a lower overlay opacity,
+// or it's higher when neither meets the target.
+func better(a, b *ContrastReport) bool {
+	aMet, bMet := a.Ratio >= a.Target, b.Ratio >= b.Target
+
+	if aMet != bMet {
+		return aMet
+	}
+
+	if aMet {
+		return a.Opacity < b.Opacity
+	}
+
+	return a.Ratio > b.Ratio
+}
+
+// textBoxes returns the boxes of the text elements with their colors in the theme, sync with drawAuthor, drawTitle,
+// drawSubtitle and drawMeta.
+func (p *Preview) textBoxes(t theme) []textBox {
+	right := p.opts.CanvasW - int(padding)
+	titleY := int(padding*2) + p.opts.AvaD
+	titleRect := image.Rect(int(padding), titleY, right, p.opts.CanvasH-p.opts.LogoH-int(padding*1.5))
+	boxes := []textBox{{
+		element: "title",
+		rect:    titleRect,
+		color:   p.opts.TitleTypography.textColor(t.title),
+	}}
+
+	// the subtitle shares the box with the title, its lines are only known once the title is wrapped
+	if p.opts.Subtitle != "" {
+		boxes = append(boxes, textBox{element: "subtitle", rect: titleRect, color: t.author})
+	}
+
+	if len(p.opts.Meta.items()) > 0 || len(p.opts.Meta.Tags) > 0 {
+		boxes = append(boxes, textBox{element: "meta", rect: p.metaBox(), color: t.author})
+	}
+
+	if len(p.authors()) > 0 {
+		authorY := int(padding) + p.opts.AvaD/2
+
+		boxes = append(boxes, textBox{
+			element: "author",
+			rect: image.Rect(
+				int(p.authorX()), authorY-int(p.opts.AuthorSize/2),
+				right, authorY+int(p.opts.AuthorSize/2),
+			),
+			color: p.opts.AuthorTypography.textColor(t.author),
+		})
+	}
+
+	return boxes
+}
+
+// minOpacity finds the lowest overlay opacity at which all the boxes have the target contrast ratio,
+// the coverages are the shares of the opacity over the boxes. The boxes the overlay doesn't reach are skipped.
+// It returns 1 when the target can't be met.
+func minOpacity(t theme, boxes []textBox, ranges []luminanceRange, coverages []float64, target float64) float64 {
+	meets := func(opacity float64) bool {
+		for i, box := range boxes {
+			if coverages[i] > 0 && boxContrast(t, box, ranges[i], opacity*coverages[i]) < target {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if meets(0) {
+		return 0
+	}
+
+	lo, hi := 0.0, 1.0
+
+	for i := 0; i < opacitySteps; i++ {
+		if mid := (lo + hi) / 2; meets(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return hi
+}
+
+// boxContrast returns the contrast ratio of the box text color and the background under the overlay of the opacity.
+// The background is the lightest part under a light text or the darkest one under a dark text.
+func boxContrast(t theme, box textBox, lum luminanceRange, opacity float64) float64 {
+	text := toNRGBA(box.color)
+	bg := lum.light
+
+	if luminance(text) < luminance(t.overlay) {
+		bg = lum.dark
+	}
+
+	// backgrounds are compared as grays of the same luminance, the overlay and the text are blended in sRGB like gg does
+	gray := delinearize(bg)
+	under := blend(color.NRGBA{R: gray, G: gray, B: gray, A: 255}, t.overlay, opacity)
+
+	return contrastRatio(luminance(blend(under, text, float64(text.A)/255)), luminance(under))
+}
+
+// measureLuminance returns the luminance range of the image pixels within the rectangle.
+func measureLuminance(img image.Image, r image.Rectangle) luminanceRange {
+	r = r.Intersect(img.Bounds())
+	hist := make([]int, luminanceBins)
+	total := 0
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			l := luminance(toNRGBA(img.At(x, y)))
+			hist[min(int(l*luminanceBins), luminanceBins-1)]++
+			total++
+		}
+	}
+
+	if total == 0 {
+		return luminanceRange{}
+	}
+
+	percentile := func(share float64) float64 {
+		n := int(math.Ceil(share * float64(total)))
+
+		for i, count := range hist {
+			if n -= count; n <= 0 {
+				return (float64(i) + 0.5) / luminanceBins
+			}
+		}
+
+		return 1
+	}
+
+	return luminanceRange{dark: percentile(1 - contrastPercentile), light: percentile(contrastPercentile)}
+}
+
+// toNRGBA converts the color to the non-premultiplied one. Unlike color.NRGBAModel, it clamps the channels
+// of invalid premultiplied colors, e.g. the default author one, to the alpha instead of overflowing.
+func toNRGBA(c color.Color) color.NRGBA {
+	r, g, b, a := c.RGBA()
+
+	if a == 0 {
+		return color.NRGBA{}
+	}
+
+	channel := func(v uint32) uint8 {
+		return uint8(min(v, a) * 0xffff / a >> 8)
+	}
+
+	return color.NRGBA{R: channel(r), G: channel(g), B: channel(b), A: uint8(a >> 8)}
+}
+
+// blend draws the color c of the opacity over the opaque color dst.
+func blend(dst, c color.NRGBA, opacity float64) color.NRGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-opacity) + float64(b)*opacity))
+	}
+
+	return color.NRGBA{R: mix(dst.R, c.R), G: mix(dst.G, c.G), B: mix(dst.B, c.B), A: 255}
+}
+
+// luminance returns the WCAG relative luminance of the color ignoring its alpha.
+func luminance(c color.NRGBA) float64 {
+	return 0.2126*linear[c.R] + 0.7152*linear[c.G] + 0.0722*linear[c.B]
+}
+
+// contrastRatio returns the WCAG contrast ratio of two relative luminances, from 1 to 21.
+func contrastRatio(a, b float64) float64 {
+	return (math.Max(a, b) + 0.05) / (math.Min(a, b) + 0.05)
+}
+
+// linear maps the sRGB channel values to the linear light.
+var linear = func() (table [256]float64) {
+	for v := range table {
+		if c := float64(v) / 255; c <= 0.04045 {
+			table[v] = c / 12.92
+		} else {
+			table[v] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+
+	return table
+}()
+
+// delinearize converts the linear light to an sRGB channel value.
+func delinearize(l float64) uint8 {
+	c := l * 12.92
+
+	if l > 0.0031308 {
+		c = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+
+	return uint8(math.Round(math.Max(0, math.Min(1, c)) * 255))
+}
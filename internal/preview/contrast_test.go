@@ -0,0 +1,141 @@
+package preview
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestContrastRatio(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a, b     color.NRGBA
+		expected float64
+	}{{
+		name:     "black on white",
+		a:        color.NRGBA{A: 255},
+		b:        color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		expected: 21,
+	}, {
+		name:     "gray on white",
+		a:        color.NRGBA{R: 118, G: 118, B: 118, A: 255},
+		b:        color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		expected: 4.54,
+	}, {
+		name:     "same colors",
+		a:        color.NRGBA{R: 10, G: 20, B: 30, A: 255},
+		b:        color.NRGBA{R: 10, G: 20, B: 30, A: 255},
+		expected: 1,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := contrastRatio(luminance(tt.a), luminance(tt.b)); math.Abs(actual-tt.expected) > 0.01 {
+				t.Errorf("%v on %v: expected %v, got %v", tt.a, tt.b, tt.expected, actual)
+			}
+		})
+	}
+
+	for v := 0; v < 256; v++ {
+		if actual := delinearize(linear[v]); int(actual) != v {
+			t.Fatalf("expected %d to be converted back, got %d", v, actual)
+		}
+	}
+}
+
+func TestAutoContrast(t *testing.T) {
+	testCases := []struct {
+		name       string
+		bg         string
+		overlay    Overlay
+		target     float64
+		theme      string
+		minOpacity float64
+		maxOpacity float64
+		met        bool
+	}{{
+		name:       "dark background needs no overlay",
+		bg:         "#000000",
+		target:     ContrastAA,
+		theme:      "dark",
+		minOpacity: 0,
+		maxOpacity: 0,
+		met:        true,
+	}, {
+		name:       "light background needs no overlay",
+		bg:         "#FFFFFF",
+		target:     ContrastAA,
+		theme:      "light",
+		minOpacity: 0,
+		maxOpacity: 0,
+		met:        true,
+	}, {
+		name:       "mid gray needs an overlay",
+		bg:         "#808080",
+		target:     ContrastAA,
+		minOpacity: 0.01,
+		maxOpacity: 0.99,
+		met:        true,
+	}, {
+		name:       "mid gray needs a stronger overlay",
+		bg:         "#808080",
+		target:     7,
+		minOpacity: 0.01,
+		maxOpacity: 0.99,
+		met:        true,
+	}, {
+		name:       "gradient fading out under the author",
+		bg:         "#808080",
+		overlay:    Overlay{Fill: OverlayLinear, Angle: 90},
+		target:     7,
+		minOpacity: 1,
+		maxOpacity: 1,
+		met:        false,
+	}, {
+		name:       "gradient over a dark background",
+		bg:         "#000000",
+		overlay:    Overlay{Fill: OverlayLinear, Angle: 90},
+		target:     ContrastAA,
+		theme:      "dark",
+		minOpacity: 0,
+		maxOpacity: 0,
+		met:        true,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preview{
+				opts: &Options{
+					CanvasW:    600,
+					CanvasH:    315,
+					AvaD:       32,
+					LogoH:      24,
+					Author:     "@Tester",
+					AuthorSize: 18,
+					Contrast:   tt.target,
+					Overlay:    tt.overlay,
+				},
+				ctx: gg.NewContext(600, 315),
+			}
+
+			p.ctx.SetHexColor(tt.bg)
+			p.ctx.Clear()
+
+			th, opacity, report := p.autoContrast()
+
+			if tt.theme != "" && th.name != tt.theme {
+				t.Errorf("expected the %s theme, got %s", tt.theme, th.name)
+			}
+
+			if opacity < tt.minOpacity || opacity > tt.maxOpacity || opacity != report.Opacity {
+				t.Errorf("expected the opacity from %v to %v, got %v", tt.minOpacity, tt.maxOpacity, opacity)
+			}
+
+			if len(report.Elements) != 2 || (report.Ratio >= tt.target) != tt.met {
+				t.Errorf("expected the elements to meet the contrast %v: %+v", tt.met, report)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// faceThumbnail is the max side of the image thumbnail the faces are detected in
+	faceThumbnail = 480
+	// faceMinSize is the min size of a face relative to the shorter side of the image
+	faceMinSize = 0.1
+	// faceQuality is the min detection score of a face, lower ones are mostly false positives
+	faceQuality = 5.0
+	// faceIoU is the min overlap of the detections of the same face at different scales
+	faceIoU = 0.2
+)
+
+// facefinder is the pigo face detection cascade
+//
+//go:embed cascades/facefinder
+var facefinder []byte
+
+var detector struct {
+	once    sync.Once
+	cascade *pigo.Pigo
+	err     error
+}
+
+// faceCascade returns the face detection cascade unpacked on the first use.
+func faceCascade() (*pigo.Pigo, error) {
+	detector.once.Do(func() {
+		detector.cascade, detector.err = pigo.NewPigo().Unpack(facefinder)
+	})
+
+	return detector.cascade, detector.err
+}
+
+// faceFocus detects the faces in the image and returns the center of the box around them as the focal point,
+// or nil when there are no faces.
+func faceFocus(ctx context.Context, buf []byte) (_ *Focus, err error) {
+	startedAt := time.Now()
+	ctx, span := tracing.Start(ctx, "preview.faceFocus")
+
+	defer func() { tracing.End(span, err) }()
+
+	cascade, err := faceCascade()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not unpack the face cascade: %w", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width > faceThumbnail || config.Height > faceThumbnail {
+		if buf, err = thumbnail(ctx, buf, faceThumbnail); err != nil {
+			return nil, fmt.Errorf("could not downscale the image: %w", err)
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the image: %w", err)
+	}
+
+	faces := detectFaces(cascade, img)
+
+	span.SetAttributes(attribute.Int("faces", len(faces)))
+	slog.DebugContext(ctx, "detected faces", "faces", len(faces), "took", time.Since(startedAt))
+
+	if len(faces) == 0 {
+		return nil, nil
+	}
+
+	box := faces[0]
+
+	for _, face := range faces[1:] {
+		box = box.Union(face)
+	}
+
+	cols, rows := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+
+	return &Focus{
+		X: (float64(box.Min.X+box.Max.X) / 2) / cols,
+		Y: (float64(box.Min.Y+box.Max.Y) / 2) / rows,
+	}, nil
+}
+
+// focusOnFaces returns the focal point of the faces found in the asset and reports it. It returns nil
+// when there are no faces or the asset has the aspect ratio of the size, so there's nothing to crop.
+func (p *Preview) focusOnFaces(ctx context.Context, key string, buf []byte, w, h int) (*Focus, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the %s: %w", key, err)
+	}
+
+	if config.Width*h == config.Height*w {
+		return nil, nil
+	}
+
+	startedAt := time.Now()
+	focus, err := faceFocus(ctx, buf)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not detect faces in the %s: %w", key, err)
+	}
+
+	p.report.timing("faces", key, startedAt)
+
+	if asset, ok := p.report.Assets[key]; ok {
+		asset.Focus = focus
+	}
+
+	return focus, nil
+}
+
+// detectFaces returns the boxes of the faces found in the image relative to its bounds.
+func detectFaces(cascade *pigo.Pigo, img image.Image) []image.Rectangle {
+	cols, rows := img.Bounds().Dx(), img.Bounds().Dy()
+	side := min(cols, rows)
+	params := pigo.CascadeParams{
+		MinSize:     max(20, int(math.Round(float64(side)*faceMinSize))),
+		MaxSize:     side,
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: pigo.RgbToGrayscale(img),
+			Rows:   rows,
+			Cols:   cols,
+			Dim:    cols,
+		},
+	}
+
+	var faces []image.Rectangle
+
+	for _, d := range cascade.ClusterDetections(cascade.RunCascade(params, 0), faceIoU) {
+		if d.Q < faceQuality {
+			continue
+		}
+
+		half := d.Scale / 2
+		faces = append(faces, image.Rect(d.Col-half, d.Row-half, d.Col+half, d.Row+half))
+	}
+
+	return faces
+}
@@ -0,0 +1,117 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestFaceFocus(t *testing.T) {
+	face := syntheticFace(160)
+
+	// the face is placed at the right edge of a wide gray image
+	src := image.NewNRGBA(image.Rect(0, 0, face.Bounds().Dx()*3, face.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.NRGBA{R: 128, G: 128, B: 128, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(src, face.Bounds().Add(image.Pt(face.Bounds().Dx()*2, 0)), face, face.Bounds().Min, draw.Src)
+
+	blank := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+
+	testCases := []struct {
+		name string
+		img  image.Image
+		// expected horizontal range of the focal point, an empty one expects no faces
+		from, to float64
+	}{{
+		name: "face on the right",
+		img:  src,
+		from: 2.0 / 3,
+		to:   1,
+	}, {
+		name: "no faces",
+		img:  blank,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+
+			if err := png.Encode(buf, tt.img); err != nil {
+				t.Fatal(err)
+			}
+
+			focus, err := faceFocus(context.Background(), buf.Bytes())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.from == tt.to {
+				if focus != nil {
+					t.Errorf("expected no faces, got a focal point at %+v", focus)
+				}
+
+				return
+			}
+
+			if focus == nil || focus.X < tt.from || focus.X > tt.to || focus.Y <= 0 || focus.Y >= 1 {
+				t.Errorf("expected the focal point between x %.2f and %.2f, got %+v", tt.from, tt.to, focus)
+			}
+		})
+	}
+}
+
+// syntheticFace draws a gray face of the size: a light oval with hair, brows, eyes, a nose and a mouth
+// blurred enough for the cascade, which is trained on photos.
+func syntheticFace(size int) image.Image {
+	s := float64(size)
+	dc := gg.NewContext(size, size)
+
+	dc.SetRGB255(90, 90, 90)
+	dc.Clear()
+
+	shapes := []struct {
+		gray uint8
+		draw func()
+	}{
+		{200, func() { dc.DrawEllipse(s*0.5, s*0.5, s*0.32, s*0.42) }},
+		{35, func() { dc.DrawEllipticalArc(s*0.5, s*0.38, s*0.34, s*0.32, math.Pi, 2*math.Pi) }},
+		{130, func() {
+			dc.DrawEllipse(s*0.38, s*0.46, s*0.08, s*0.045)
+			dc.DrawEllipse(s*0.62, s*0.46, s*0.08, s*0.045)
+		}},
+		{30, func() {
+			dc.DrawCircle(s*0.38, s*0.46, s*0.025)
+			dc.DrawCircle(s*0.62, s*0.46, s*0.025)
+		}},
+		{160, func() { dc.DrawEllipse(s*0.5, s*0.6, s*0.05, s*0.03) }},
+		{80, func() { dc.DrawEllipse(s*0.5, s*0.72, s*0.09, s*0.025) }},
+	}
+
+	for _, shape := range shapes {
+		dc.SetColor(color.Gray{Y: shape.gray})
+		shape.draw()
+		dc.Fill()
+	}
+
+	dc.SetColor(color.Gray{Y: 45})
+	dc.SetLineWidth(s * 0.025)
+	dc.DrawLine(s*0.32, s*0.4, s*0.44, s*0.39)
+	dc.DrawLine(s*0.56, s*0.39, s*0.68, s*0.4)
+	dc.Stroke()
+
+	gray := image.NewGray(image.Rect(0, 0, size, size))
+	draw.Draw(gray, gray.Bounds(), dc.Image(), image.Point{}, draw.Src)
+
+	// the lightness is blurred as a mask
+	blurred := blur(&image.Alpha{Pix: gray.Pix, Stride: gray.Stride, Rect: gray.Rect}, s*0.07)
+
+	return &image.Gray{Pix: blurred.Pix, Stride: blurred.Stride, Rect: blurred.Rect}
+}
@@ -0,0 +1,158 @@
+package preview
+
+import (
+	"bytes"
+	"container/list"
+	"embed"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"sync"
+
+	"github.com/rivo/uniseg"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	emojiFont = "Twemoji"
+	// emoji image size, advance and vertical offset of the image bottom from the baseline relative to the font size
+	emojiSize    = 1.0
+	emojiAdvance = 1.2
+	emojiDescent = 0.1
+	// maxEmojiImages is the max number of the recently used emoji images to keep decoded, about 20 KB each
+	maxEmojiImages = 512
+)
+
+// emojis holds color emoji images (Twemoji 72x72 PNGs) named by their code points, e.g. 1f468-200d-1f469-200d-1f467.png
+//
+//go:embed emoji/*.png
+var emojis embed.FS
+
+// emojiCache keeps the recently used decoded emoji images by their names.
+var emojiCache = struct {
+	sync.Mutex
+	images map[string]*list.Element
+	recent *list.List
+}{images: map[string]*list.Element{}, recent: list.New()}
+
+// cachedEmoji is a decoded emoji image, an element of the emoji cache list.
+type cachedEmoji struct {
+	name string
+	img  image.Image
+}
+
+// isEmoji reports whether the grapheme cluster is displayed as an emoji by default or explicitly requested to be.
+func isEmoji(cluster string) bool {
+	if strings.ContainsRune(cluster, '\ufe0e') {
+		return false
+	}
+
+	return uniseg.StringWidth(cluster) == 2 || strings.ContainsAny(cluster, "\ufe0f\u20e3")
+}
+
+// emojiImage returns a color image for the grapheme cluster if it's an emoji and there's an image for it.
+func emojiImage(cluster string) (image.Image, bool) {
+	if !isEmoji(cluster) {
+		return nil, false
+	}
+
+	codepoints := []string{}
+
+	for _, r := range cluster {
+		codepoints = append(codepoints, fmt.Sprintf("%x", r))
+	}
+
+	name := strings.Join(codepoints, "-")
+
+	// images of sequences without a joiner are named without the emoji variation selector
+	for _, key := range []string{name, strings.ReplaceAll(name, "-fe0f", "")} {
+		if img, ok := loadEmoji(key); ok {
+			return img, true
+		}
+	}
+
+	return nil, false
+}
+
+// loadEmoji returns the decoded emoji image of the name from the cache or the embedded images,
+// evicting the least recently used one when there are too many.
+func loadEmoji(name string) (image.Image, bool) {
+	emojiCache.Lock()
+
+	if el, ok := emojiCache.images[name]; ok {
+		emojiCache.recent.MoveToFront(el)
+		emojiCache.Unlock()
+
+		return el.Value.(*cachedEmoji).img, true
+	}
+
+	emojiCache.Unlock()
+
+	buf, err := emojis.ReadFile("emoji/" + name + ".png")
+
+	if err != nil {
+		return nil, false
+	}
+
+	img, err := png.Decode(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, false
+	}
+
+	emojiCache.Lock()
+	defer emojiCache.Unlock()
+
+	// another render might have decoded it meanwhile
+	if el, ok := emojiCache.images[name]; ok {
+		emojiCache.recent.MoveToFront(el)
+
+		return el.Value.(*cachedEmoji).img, true
+	}
+
+	emojiCache.images[name] = emojiCache.recent.PushFront(&cachedEmoji{name: name, img: img})
+
+	if emojiCache.recent.Len() > maxEmojiImages {
+		oldest := emojiCache.recent.Back()
+		emojiCache.recent.Remove(oldest)
+		delete(emojiCache.images, oldest.Value.(*cachedEmoji).name)
+	}
+
+	return img, true
+}
+
+// emojiKey identifies an emoji image scaled to a size.
+type emojiKey struct {
+	img  image.Image
+	size int
+}
+
+// scaledEmoji returns the emoji image scaled to the square of the given size.
+// Scaled images are cached for the render since text effects and markup draw the same emojis several times.
+func (p *Preview) scaledEmoji(img image.Image, size int) image.Image {
+	key := emojiKey{img: img, size: size}
+
+	if scaled, ok := p.emojis[key]; ok {
+		return scaled
+	}
+
+	scaled := scaleEmoji(img, size)
+
+	if p.emojis == nil {
+		p.emojis = map[emojiKey]image.Image{}
+	}
+
+	p.emojis[key] = scaled
+
+	return scaled
+}
+
+// scaleEmoji scales the emoji image to the square of the given size.
+func scaleEmoji(img image.Image, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Over, nil)
+
+	return dst
+}
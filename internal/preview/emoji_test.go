@@ -0,0 +1,138 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmojiImage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cluster string
+		found   bool
+	}{{
+		name:    "emoji",
+		cluster: "🔥",
+		found:   true,
+	}, {
+		name:    "zwj sequence",
+		cluster: family,
+		found:   true,
+	}, {
+		name:    "flag",
+		cluster: "🇺🇦",
+		found:   true,
+	}, {
+		name:    "skin tone",
+		cluster: "👍🏽",
+		found:   true,
+	}, {
+		name:    "emoji presentation",
+		cluster: "🛠️",
+		found:   true,
+	}, {
+		name:    "keycap",
+		cluster: "#️⃣",
+		found:   true,
+	}, {
+		name:    "text presentation",
+		cluster: "☺︎",
+		found:   false,
+	}, {
+		name:    "text default",
+		cluster: "☺",
+		found:   false,
+	}, {
+		name:    "letter",
+		cluster: "A",
+		found:   false,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, found := emojiImage(tt.cluster); found != tt.found {
+				t.Errorf("expected found %v, got %v", tt.found, found)
+			}
+		})
+	}
+}
+
+func TestLoadEmoji_Evict(t *testing.T) {
+	if _, ok := loadEmoji("1f525"); !ok {
+		t.Fatal("expected the emoji image to be found")
+	}
+
+	entries, err := emojis.ReadDir("emoji")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := 0
+
+	for _, entry := range entries {
+		if name := strings.TrimSuffix(entry.Name(), ".png"); name != "1f525" && loaded < maxEmojiImages {
+			if _, ok := loadEmoji(name); ok {
+				loaded++
+			}
+		}
+	}
+
+	emojiCache.Lock()
+	defer emojiCache.Unlock()
+
+	if n := emojiCache.recent.Len(); n != maxEmojiImages || len(emojiCache.images) != n {
+		t.Errorf("expected %d emoji images, got %d", maxEmojiImages, n)
+	}
+
+	if _, ok := emojiCache.images["1f525"]; ok {
+		t.Error("expected the least recently used emoji image to be evicted")
+	}
+}
+
+func TestSegments(t *testing.T) {
+	segs := segments("Hot 🔥🔥 stuff")
+	texts := []string{}
+
+	for _, seg := range segs {
+		texts = append(texts, seg.text)
+	}
+
+	if len(segs) != 4 || segs[1].emoji == nil || segs[2].emoji == nil || segs[0].emoji != nil || segs[3].emoji != nil {
+		t.Fatalf("unexpected segments: %q", texts)
+	}
+
+	if texts[0] != "Hot " || texts[3] != " stuff" {
+		t.Errorf("unexpected text segments: %q", texts)
+	}
+}
+
+func TestMeasureEmoji(t *testing.T) {
+	p := newTestPreview(t, 40)
+
+	if w := p.measure("🔥" + family); w != 2*40*emojiAdvance {
+		t.Errorf("expected emojis width %v, got %v", 2*40*emojiAdvance, w)
+	}
+
+	if w := p.measure("a🔥"); w != p.measure("a")+40*emojiAdvance {
+		t.Errorf("expected text and emoji width %v, got %v", p.measure("a")+40*emojiAdvance, w)
+	}
+}
+
+func TestScaledEmoji(t *testing.T) {
+	p := newTestPreview(t, 40)
+	img, _ := emojiImage("🔥")
+	scaled := p.scaledEmoji(img, 40)
+
+	if scaled.Bounds().Dx() != 40 || scaled.Bounds().Dy() != 40 {
+		t.Errorf("expected a 40x40 emoji, got %v", scaled.Bounds())
+	}
+
+	if p.scaledEmoji(img, 40) != scaled {
+		t.Error("expected the scaled emoji to be reused")
+	}
+
+	if p.scaledEmoji(img, 20) == scaled {
+		t.Error("expected the emoji to be scaled to another size")
+	}
+}
@@ -1,107 +1,788 @@
 package preview
 
 import (
+	"bytes"
+	"container/list"
 	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/AndreKR/multiface"
+	otfont "github.com/go-text/typesetting/font"
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomediumitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultFamily is the font family of the title and the author unless another one is requested
+const DefaultFamily = "Ubuntu"
+
+// FontManifest is the name of the file in the fonts directory describing the font families to register
+const FontManifest = "fonts.json"
+
+// Weight is a font weight from 100 (thin) to 900 (black).
+type Weight int
+
+const (
+	WeightRegular Weight = 400
+	WeightMedium  Weight = 500
+	WeightBold    Weight = 700
+)
+
+// Style is a font style.
+type Style string
+
+const (
+	StyleNormal Style = "normal"
+	StyleItalic Style = "italic"
 )
 
 const (
-	textFont    = "fonts/Ubuntu-Medium.ttf"
-	symbolsFont = "fonts/NotoSansSymbols-Medium.ttf"
-	emoji1Font  = "fonts/NotoEmoji-Regular.ttf"
-	emoji2Font  = "fonts/Symbola.ttf"
+	// Font sizes are rounded and clamped to the range to keep the number of face pools finite
+	minFontSize = 1.0
+	maxFontSize = 200.0
+	// maxFacePools is the max number of the recently used font specs to keep the face pools for
+	maxFacePools = 256
 )
 
+// fauxBold is the stroke width added to glyphs of a font emboldened synthetically
+// for each 100 of the weight missing in the family, relative to the font size
+const fauxBold = 0.012
+
+// defaultFallback is the fallback chain of the families registered without one:
+// symbols and monochrome emojis missing in the family fonts
+var defaultFallback = []string{"Noto Sans Symbols", "Noto Emoji", "Symbola"}
+
+// scriptFamilies are the fallback families for complex scripts shared by all families.
+// They're tried right after the family font, but only for shaped text, see needsShaping.
+var scriptFamilies = []string{"Noto Sans Arabic", "Noto Sans Devanagari", "DejaVu Sans"}
+
+var errUnknownFamily = errors.New("unknown font family")
+
 //go:embed fonts/*
 var fonts embed.FS
-var cache sync.Map
 
-// loadFont loads a multiface consisting of letters, symbols and emojis merged to one font face.
-// It caches the result in memory for each font size to avoid multiface creation on each request
-func loadFont(points float64) (font.Face, error) {
-	if cached, exists := cache.Load(points); exists {
-		if face, ok := cached.(font.Face); ok {
-			return face, nil
-		}
+// faces keeps a pool of font faces for each of the recently used font specs. The parsed fonts are shared,
+// but the faces cache rasterized glyphs and aren't safe for concurrent use.
+var faces = struct {
+	sync.Mutex
+	pools  map[fontSpec]*list.Element
+	recent *list.List
+}{pools: map[fontSpec]*list.Element{}, recent: list.New()}
+
+// facePool is a pool of font faces of the spec, an element of the faces list.
+type facePool struct {
+	spec fontSpec
+	pool sync.Pool
+}
+
+// fontFile is a font from the embedded fonts, the Go fonts or the fonts directory parsed on the first use.
+type fontFile struct {
+	// file name without an extension reported in glyph runs
+	name   string
+	weight Weight
+	style  Style
+	read   func() ([]byte, error)
+	// index of the font in a fonts collection
+	index int
+	// code points of the fonts from the fonts directory, see packFor
+	coverage []runeRange
+
+	once sync.Once
+	// nil for the fonts freetype can't parse
+	tt  *truetype.Font
+	ot  *otfont.Font
+	err error
+}
+
+// fontManifest lists the font families to register with their font files and fallback chains.
+// Paths of the files are relative to the manifest. A family without fallback keeps the default chain,
+// an empty one disables the fallback.
+type fontManifest struct {
+	Families []struct {
+		Name     string   `json:"name"`
+		Fallback []string `json:"fallback"`
+		Fonts    []struct {
+			File   string `json:"file"`
+			Weight string `json:"weight"`
+			Style  string `json:"style"`
+		} `json:"fonts"`
+	} `json:"families"`
+}
+
+// fontFamily is a set of font variants of different weights and styles with a fallback chain of families.
+type fontFamily struct {
+	name     string
+	variants []*fontFile
+	fallback []string
+}
+
+// registry keeps the font families by their lowercase names.
+var registry = struct {
+	sync.RWMutex
+	families map[string]*fontFamily
+}{families: map[string]*fontFamily{}}
+
+// fontChain is a font variant of a family followed by its fallback fonts.
+type fontChain struct {
+	primary  *fontFile
+	scripts  []*fontFile
+	fallback []*fontFile
+}
+
+// fontSpec identifies a font face of the family variant closest to the weight and the style.
+type fontSpec struct {
+	family string
+	weight Weight
+	style  Style
+	size   float64
+}
+
+// newFontSpec returns the font spec falling back to the default family, the medium weight and the normal style for empty values.
+// The size is rounded to an integer within the font sizes range.
+func newFontSpec(familyName string, weight Weight, style Style, size float64) fontSpec {
+	if familyName == "" {
+		familyName = DefaultFamily
 	}
 
-	face := new(multiface.Face)
-	textBuf, err := fonts.ReadFile(textFont)
+	if weight == 0 {
+		weight = WeightMedium
+	}
 
-	if err != nil {
-		return nil, err
+	if style == "" {
+		style = StyleNormal
+	}
+
+	size = math.Round(min(max(size, minFontSize), maxFontSize))
+
+	return fontSpec{family: familyName, weight: weight, style: style, size: size}
+}
+
+func init() {
+	for _, f := range []struct {
+		family, path string
+		weight       Weight
+	}{
+		{"Ubuntu", "fonts/Ubuntu-Medium.ttf", WeightMedium},
+		{"Noto Sans Arabic", "fonts/NotoSansArabic-Regular.ttf", WeightRegular},
+		{"Noto Sans Devanagari", "fonts/NotoSansDevanagari-Regular.ttf", WeightRegular},
+		{"DejaVu Sans", "fonts/DejaVuSans.ttf", WeightRegular},
+		{"Noto Sans Symbols", "fonts/NotoSansSymbols-Medium.ttf", WeightMedium},
+		{"Noto Emoji", "fonts/NotoEmoji-Regular.ttf", WeightRegular},
+		{"Symbola", "fonts/Symbola.ttf", WeightRegular},
+	} {
+		path := f.path
+
+		registerFont(f.family, &fontFile{
+			name:   strings.TrimSuffix(strings.TrimPrefix(path, "fonts/"), ".ttf"),
+			weight: f.weight,
+			style:  StyleNormal,
+			read:   func() ([]byte, error) { return fonts.ReadFile(path) },
+		})
+	}
+
+	for _, f := range []struct {
+		family, name string
+		buf          []byte
+		weight       Weight
+		style        Style
+	}{
+		{"Go", "Go-Regular", goregular.TTF, WeightRegular, StyleNormal},
+		{"Go", "Go-Italic", goitalic.TTF, WeightRegular, StyleItalic},
+		{"Go", "Go-Medium", gomedium.TTF, WeightMedium, StyleNormal},
+		{"Go", "Go-Medium-Italic", gomediumitalic.TTF, WeightMedium, StyleItalic},
+		{"Go", "Go-Bold", gobold.TTF, WeightBold, StyleNormal},
+		{"Go", "Go-Bold-Italic", gobolditalic.TTF, WeightBold, StyleItalic},
+		{codeFamily, "Go-Mono", gomono.TTF, WeightRegular, StyleNormal},
+		{codeFamily, "Go-Mono-Italic", gomonoitalic.TTF, WeightRegular, StyleItalic},
+		{codeFamily, "Go-Mono-Bold", gomonobold.TTF, WeightBold, StyleNormal},
+		{codeFamily, "Go-Mono-Bold-Italic", gomonobolditalic.TTF, WeightBold, StyleItalic},
+	} {
+		buf := f.buf
+
+		registerFont(f.family, &fontFile{
+			name:   f.name,
+			weight: f.weight,
+			style:  f.style,
+			read:   func() ([]byte, error) { return buf, nil },
+		})
 	}
 
-	textFont, err := truetype.Parse(textBuf)
+	// the fallback fonts don't fall back any further
+	for _, name := range append(scriptFamilies, defaultFallback...) {
+		RegisterFamily(name)
+	}
+}
+
+// ParseWeight parses a weight name (regular, medium or bold) or a number from 100 to 900.
+func ParseWeight(s string) (Weight, error) {
+	switch strings.ToLower(s) {
+	case "regular", "normal":
+		return WeightRegular, nil
+	case "medium":
+		return WeightMedium, nil
+	case "bold":
+		return WeightBold, nil
+	}
+
+	w, err := strconv.Atoi(s)
+
+	if err != nil || w < 100 || w > 900 {
+		return 0, fmt.Errorf("invalid font weight %q", s)
+	}
+
+	return Weight(w), nil
+}
+
+// ParseStyle parses a style name: normal or italic.
+func ParseStyle(s string) (Style, error) {
+	switch style := Style(strings.ToLower(s)); style {
+	case StyleNormal, StyleItalic:
+		return style, nil
+	default:
+		return "", fmt.Errorf("invalid font style %q", s)
+	}
+}
+
+// RegisterFamily adds a font family or replaces the fallback chain of an existing one.
+// The fallback families are tried in order for characters missing in the family fonts.
+func RegisterFamily(name string, fallback ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	key := strings.ToLower(name)
+
+	if f, ok := registry.families[key]; ok {
+		f.fallback = fallback
+		return
+	}
+
+	registry.families[key] = &fontFamily{name: name, fallback: fallback}
+}
+
+// RegisterFont adds a TTF, OTF or TTC font file on disk to the family as a variant of the given weight and style.
+// A new family falls back to the embedded symbol and emoji fonts. The font is parsed on the first use.
+func RegisterFont(familyName, path string, weight Weight, style Style) error {
+	faces, err := parseFontFile(path)
 
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("could not parse a font: %w", err)
 	}
 
-	textFace := truetype.NewFace(textFont, &truetype.Options{
-		Size: points,
+	registerFont(familyName, &fontFile{
+		name:   fontName(path, 0, len(faces)),
+		weight: weight,
+		style:  style,
+		read:   readFile(path),
 	})
 
-	face.AddTruetypeFace(textFace, textFont)
+	return nil
+}
 
-	symbolsBuf, err := fonts.ReadFile(symbolsFont)
+// LoadFontManifest registers the font families of the manifest file, see FontManifest,
+// returning the number of fonts registered. It should be called once at startup.
+func LoadFontManifest(path string) (int, error) {
+	buf, err := os.ReadFile(path)
 
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("could not read the font manifest: %w", err)
 	}
 
-	symbolsFont, err := truetype.Parse(symbolsBuf)
+	manifest := fontManifest{}
 
-	if err != nil {
-		return nil, err
+	if err = json.Unmarshal(buf, &manifest); err != nil {
+		return 0, fmt.Errorf("could not parse the font manifest: %w", err)
+	}
+
+	found := 0
+
+	for _, f := range manifest.Families {
+		if f.Name == "" {
+			return found, errors.New("a family of the font manifest has no name")
+		}
+
+		for _, entry := range f.Fonts {
+			weight, style := WeightRegular, StyleNormal
+
+			if entry.Weight != "" {
+				if weight, err = ParseWeight(entry.Weight); err != nil {
+					return found, err
+				}
+			}
+
+			if entry.Style != "" {
+				if style, err = ParseStyle(entry.Style); err != nil {
+					return found, err
+				}
+			}
+
+			file := entry.File
+
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(path), file)
+			}
+
+			if err = RegisterFont(f.Name, file, weight, style); err != nil {
+				return found, fmt.Errorf("could not register %s: %w", entry.File, err)
+			}
+
+			found++
+		}
+
+		if f.Fallback != nil {
+			RegisterFamily(f.Name, f.Fallback...)
+		}
+	}
+
+	// the fallback families may be registered by the manifest itself
+	for _, f := range manifest.Families {
+		for _, name := range append([]string{f.Name}, f.Fallback...) {
+			if !HasFamily(name) {
+				return found, fmt.Errorf("%w in the font manifest: %s", errUnknownFamily, name)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// HasFamily reports whether the font family is registered.
+func HasFamily(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.families[strings.ToLower(name)]
+
+	return ok && len(f.variants) > 0
+}
+
+// registerFont adds the font to the family creating the family with the default fallback chain if needed.
+func registerFont(familyName string, ff *fontFile) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	key := strings.ToLower(familyName)
+	f, ok := registry.families[key]
+
+	if !ok {
+		f = &fontFamily{name: familyName, fallback: defaultFallback}
+		registry.families[key] = f
+	}
+
+	f.variants = append(f.variants, ff)
+}
+
+// unregisterFamily removes the font family, the families of the fallback chains are kept.
+func unregisterFamily(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.families, strings.ToLower(name))
+}
+
+// variant returns the font closest to the weight preferring the same style.
+// When two fonts are equally close, the heavier one wins.
+func (f *fontFamily) variant(weight Weight, style Style) *fontFile {
+	var best *fontFile
+	bestDistance := 0
+
+	for _, ff := range f.variants {
+		distance := int(math.Abs(float64(ff.weight - weight)))
+
+		if ff.style != style {
+			distance += 1000
+		}
+
+		if best == nil || distance < bestDistance || (distance == bestDistance && ff.weight > best.weight) {
+			best, bestDistance = ff, distance
+		}
 	}
 
-	symbolsFace := truetype.NewFace(symbolsFont, &truetype.Options{
-		Size: points,
+	return best
+}
+
+// resolveChain returns the family variant closest to the weight and the style followed by the variants
+// of the script families and of the family fallback chain. Unknown fallback families are skipped.
+func resolveChain(name string, weight Weight, style Style) (*fontChain, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.families[strings.ToLower(name)]
+
+	if !ok || len(f.variants) == 0 {
+		return nil, fmt.Errorf("%w: %s", errUnknownFamily, name)
+	}
+
+	chain := &fontChain{primary: f.variant(weight, style)}
+	variants := func(names []string) []*fontFile {
+		result := []*fontFile{}
+
+		for _, name := range names {
+			if fb, ok := registry.families[strings.ToLower(name)]; ok && fb != f && len(fb.variants) > 0 {
+				result = append(result, fb.variant(weight, style))
+			}
+		}
+
+		return result
+	}
+
+	chain.scripts = variants(scriptFamilies)
+	chain.fallback = variants(f.fallback)
+
+	return chain, nil
+}
+
+// load loads all the fonts of the chain.
+func (c *fontChain) load() error {
+	for _, ff := range c.shaping() {
+		if err := ff.load(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// glyphs lists the fonts drawing text glyph by glyph in the fallback order.
+func (c *fontChain) glyphs() []*fontFile {
+	return append([]*fontFile{c.primary}, c.fallback...)
+}
+
+// shaping lists the fonts used for shaping in the fallback order.
+// The font packs are tried for letters in between the family font and the script fonts, see shaper.ResolveFace.
+func (c *fontChain) shaping() []*fontFile {
+	return append(append([]*fontFile{c.primary}, c.scripts...), c.fallback...)
+}
+
+// load parses the font on the first use. Only the first font of a collection can be parsed by freetype.
+func (ff *fontFile) load() error {
+	ff.once.Do(func() {
+		defer func() {
+			if ff.err != nil {
+				slog.Warn("could not load a font", "font", ff.name, "err", ff.err)
+			}
+		}()
+
+		buf, err := ff.read()
+
+		if err != nil {
+			ff.err = err
+			return
+		}
+
+		faces, err := otfont.ParseTTC(bytes.NewReader(buf))
+
+		if err != nil {
+			ff.err = err
+			return
+		}
+
+		if ff.index >= len(faces) {
+			ff.err = fmt.Errorf("no font #%d in the collection", ff.index)
+			return
+		}
+
+		ff.ot = faces[ff.index].Font
+
+		if tt, err := truetype.Parse(buf); err == nil && ff.index == 0 {
+			ff.tt = tt
+		}
+
+		if ff.coverage != nil {
+			slog.Info("loaded a font pack", "font", ff.name)
+		}
 	})
 
-	face.AddTruetypeFace(symbolsFace, symbolsFont)
+	if ff.err != nil {
+		return fmt.Errorf("could not load the %s font: %w", ff.name, ff.err)
+	}
+
+	return nil
+}
 
-	emoji1Buf, err := fonts.ReadFile(emoji1Font)
+// has reports whether the loaded font has a glyph for the rune.
+func (ff *fontFile) has(r rune) bool {
+	if ff.load() != nil {
+		return false
+	}
 
-	if err != nil {
-		return nil, err
+	_, ok := ff.ot.NominalGlyph(r)
+
+	return ok
+}
+
+// loadFont takes a font face of the spec from its pool or creates a new one. The face must be put back
+// with releaseFont after use and must not be used concurrently.
+func loadFont(spec fontSpec) (font.Face, error) {
+	if face, ok := facesOf(spec).Get().(font.Face); ok {
+		return face, nil
+	}
+
+	return newFace(spec)
+}
+
+// releaseFont puts the font face taken with loadFont back to its pool unless the pool was evicted meanwhile.
+func releaseFont(spec fontSpec, face font.Face) {
+	faces.Lock()
+	defer faces.Unlock()
+
+	if el, ok := faces.pools[spec]; ok {
+		el.Value.(*facePool).pool.Put(face)
+	}
+}
+
+// facesOf returns the face pool of the spec, evicting the least recently used one when there are too many.
+func facesOf(spec fontSpec) *sync.Pool {
+	faces.Lock()
+	defer faces.Unlock()
+
+	if el, ok := faces.pools[spec]; ok {
+		faces.recent.MoveToFront(el)
+
+		return &el.Value.(*facePool).pool
+	}
+
+	fp := &facePool{spec: spec}
+	faces.pools[spec] = faces.recent.PushFront(fp)
+
+	if faces.recent.Len() > maxFacePools {
+		oldest := faces.recent.Back()
+		faces.recent.Remove(oldest)
+		delete(faces.pools, oldest.Value.(*facePool).spec)
 	}
 
-	emoji1Font, err := truetype.Parse(emoji1Buf)
+	return &fp.pool
+}
+
+// newFace creates a multiface consisting of the family font followed by its fallback fonts merged to one font face.
+// Fallback fonts freetype can't parse are skipped, a family font like that results in a metrics only face.
+func newFace(spec fontSpec) (font.Face, error) {
+	chain, err := resolveChain(spec.family, spec.weight, spec.style)
 
 	if err != nil {
 		return nil, err
 	}
 
-	emoji1Face := truetype.NewFace(emoji1Font, &truetype.Options{
-		Size: points,
-	})
+	if err := chain.primary.load(); err != nil {
+		return nil, err
+	}
 
-	face.AddTruetypeFace(emoji1Face, emoji1Font)
+	if chain.primary.tt == nil {
+		return newMetricsFace(chain.primary, spec.size), nil
+	}
 
-	emoji2Buf, err := fonts.ReadFile(emoji2Font)
+	face := new(multiface.Face)
+
+	for _, ff := range chain.glyphs() {
+		if err := ff.load(); err != nil {
+			return nil, err
+		}
+
+		if ff.tt != nil {
+			face.AddTruetypeFace(truetype.NewFace(ff.tt, &truetype.Options{Size: spec.size}), ff.tt)
+		}
+	}
+
+	return face, nil
+}
+
+// checkFonts loads all the fonts of the default family chain and a face of them.
+func checkFonts() error {
+	chain, err := resolveChain(DefaultFamily, WeightMedium, StyleNormal)
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := chain.load(); err != nil {
+		return err
 	}
 
-	emoji2Font, err := truetype.Parse(emoji2Buf)
+	spec := newFontSpec(DefaultFamily, WeightMedium, StyleNormal, probeFontSize)
+	face, err := loadFont(spec)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	emoji2Face := truetype.NewFace(emoji2Font, &truetype.Options{
-		Size: points,
-	})
+	releaseFont(spec, face)
 
-	face.AddTruetypeFace(emoji2Face, emoji2Font)
-	cache.Store(points, face)
+	return nil
+}
 
-	return face, nil
+// metricsFace is a font face of a font freetype can't parse. It only provides metrics and advances
+// for laying text out since such fonts are always shaped, see Preview.needsShaping.
+type metricsFace struct {
+	face    *otfont.Face
+	scale   float64
+	metrics font.Metrics
+}
+
+// newMetricsFace returns a metrics only face of the font scaled to the size the same way freetype does.
+func newMetricsFace(ff *fontFile, points float64) *metricsFace {
+	face := otfont.NewFace(ff.ot)
+	extents, _ := face.FontHExtents()
+	scale := points / float64(ff.ot.Upem())
+
+	return &metricsFace{face: face, scale: scale, metrics: font.Metrics{
+		Height:  fixed.Int26_6(math.Ceil(float64(extents.Ascender-extents.Descender+extents.LineGap)*scale) * 64),
+		Ascent:  fixed.Int26_6(math.Ceil(float64(extents.Ascender)*scale) * 64),
+		Descent: fixed.Int26_6(math.Ceil(-float64(extents.Descender)*scale) * 64),
+	}}
+}
+
+func (f *metricsFace) Close() error {
+	return nil
+}
+
+func (f *metricsFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return image.Rectangle{}, nil, image.Point{}, 0, false
+}
+
+func (f *metricsFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	advance, ok := f.GlyphAdvance(r)
+
+	return fixed.Rectangle26_6{}, advance, ok
+}
+
+func (f *metricsFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	gid, ok := f.face.NominalGlyph(r)
+
+	if !ok {
+		return 0, false
+	}
+
+	return fixed.Int26_6(float64(f.face.HorizontalAdvance(gid)) * f.scale * 64), true
+}
+
+func (f *metricsFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+func (f *metricsFace) Metrics() font.Metrics {
+	return f.metrics
+}
+
+// missingGlyphs returns the visible characters of the text none of the fonts of the current chain has a glyph for,
+// checking the fonts the text would be drawn with: the shaping ones or the multiface ones.
+func (p *Preview) missingGlyphs(text string) []rune {
+	shaped := p.needsShaping(text)
+	missing := []rune{}
+	seen := map[rune]bool{}
+
+	for _, cluster := range graphemes(text) {
+		if _, ok := emojiImage(cluster); ok {
+			continue
+		}
+
+		for _, r := range cluster {
+			if seen[r] || isInvisible(r) || unicode.IsSpace(r) || unicode.In(r, unicode.Cc, unicode.Cf) {
+				continue
+			}
+
+			seen[r] = true
+
+			if !p.covers(r, shaped) {
+				missing = append(missing, r)
+			}
+		}
+	}
+
+	return missing
+}
+
+// covers reports whether any font of the current chain has a glyph for the rune.
+func (p *Preview) covers(r rune, shaped bool) bool {
+	if shaped {
+		if packFor(r) != nil {
+			return true
+		}
+
+		for _, ff := range p.chain.shaping() {
+			if ff.has(r) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, ff := range p.chain.glyphs() {
+		if ff.load() == nil && ff.tt != nil && ff.tt.Index(r) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// glyphRuns splits the visible text into runs of characters drawn with the same font of the current font chain or color emojis.
+// It picks a font for each character the same way the multiface does: the first one having a glyph for it or the last one.
+func (p *Preview) glyphRuns(text string) ([]GlyphRun, error) {
+	if p.needsShaping(text) {
+		return p.shapedGlyphRuns(text)
+	}
+
+	chain := []*fontFile{}
+
+	for _, ff := range p.chain.glyphs() {
+		if err := ff.load(); err != nil {
+			return nil, err
+		}
+
+		if ff.tt != nil {
+			chain = append(chain, ff)
+		}
+	}
+
+	runs := []GlyphRun{}
+	add := func(text, name string) {
+		if len(runs) > 0 && runs[len(runs)-1].Font == name {
+			runs[len(runs)-1].Text += text
+		} else {
+			runs = append(runs, GlyphRun{Text: text, Font: name})
+		}
+	}
+
+	for _, seg := range segments(text) {
+		if seg.emoji != nil {
+			add(seg.text, emojiFont)
+			continue
+		}
+
+		for _, r := range visible(seg.text) {
+			name := chain[len(chain)-1].name
+
+			for _, ff := range chain {
+				if ff.tt.Index(r) != 0 {
+					name = ff.name
+					break
+				}
+			}
+
+			add(string(r), name)
+		}
+	}
+
+	return runs, nil
 }
@@ -0,0 +1,365 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseWeight(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected Weight
+		ok       bool
+	}{{
+		name:     "name",
+		s:        "regular",
+		expected: WeightRegular,
+		ok:       true,
+	}, {
+		name:     "capitalized name",
+		s:        "Bold",
+		expected: WeightBold,
+		ok:       true,
+	}, {
+		name:     "number",
+		s:        "600",
+		expected: 600,
+		ok:       true,
+	}, {
+		name:     "number out of range",
+		s:        "950",
+		expected: 0,
+		ok:       false,
+	}, {
+		name:     "unknown name",
+		s:        "heavy",
+		expected: 0,
+		ok:       false,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWeight(tt.s)
+
+			if w != tt.expected || (err == nil) != tt.ok {
+				t.Errorf("%q: expected %v (ok: %v), got %v (%v)", tt.s, tt.expected, tt.ok, w, err)
+			}
+		})
+	}
+
+	if _, err := ParseStyle("oblique"); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+}
+
+func TestResolveChain(t *testing.T) {
+	testCases := []struct {
+		name     string
+		family   string
+		weight   Weight
+		style    Style
+		expected string
+	}{{
+		name:     "missing variant",
+		family:   "Ubuntu",
+		weight:   WeightBold,
+		style:    StyleItalic,
+		expected: "Ubuntu-Medium",
+	}, {
+		name:     "lowercase family",
+		family:   "go",
+		weight:   WeightRegular,
+		style:    StyleNormal,
+		expected: "Go-Regular",
+	}, {
+		name:     "bold italic",
+		family:   "Go",
+		weight:   WeightBold,
+		style:    StyleItalic,
+		expected: "Go-Bold-Italic",
+	}, {
+		name:     "closest heavier weight",
+		family:   "Go",
+		weight:   600,
+		style:    StyleNormal,
+		expected: "Go-Bold",
+	}, {
+		name:     "closest lighter italic",
+		family:   "Go",
+		weight:   300,
+		style:    StyleItalic,
+		expected: "Go-Italic",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := resolveChain(tt.family, tt.weight, tt.style)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if chain.primary.name != tt.expected {
+				t.Errorf("%s %d %s: expected %s, got %s", tt.family, tt.weight, tt.style, tt.expected, chain.primary.name)
+			}
+		})
+	}
+
+	if _, err := resolveChain("Comic Sans", WeightRegular, StyleNormal); !errors.Is(err, errUnknownFamily) {
+		t.Errorf("expected an unknown family error, got %v", err)
+	}
+}
+
+func TestRegisterFont(t *testing.T) {
+	if err := RegisterFont("Test Blank", "./testdata/fonts/AdobeBlank2.ttf", WeightRegular, StyleNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { unregisterFamily("Test Blank") })
+
+	if !HasFamily("test blank") {
+		t.Fatal("expected the family to be registered")
+	}
+
+	names := func() []string {
+		chain, err := resolveChain("Test Blank", WeightBold, StyleNormal)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := []string{}
+
+		for _, ff := range chain.glyphs() {
+			result = append(result, ff.name)
+		}
+
+		return result
+	}
+
+	expected := []string{"AdobeBlank2", "NotoSansSymbols-Medium", "NotoEmoji-Regular", "Symbola"}
+
+	if actual := names(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the default fallback chain %v, got %v", expected, actual)
+	}
+
+	RegisterFamily("Test Blank", "Symbola", "Unknown")
+
+	if actual := names(); !reflect.DeepEqual(actual, []string{"AdobeBlank2", "Symbola"}) {
+		t.Errorf("expected the custom fallback chain, got %v", actual)
+	}
+
+	p := newTestPreview(t, 40)
+
+	if err := p.setFont(newFontSpec("Test Blank", 0, "", 40)); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := p.glyphRuns("Blank ★")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 1 || !strings.HasPrefix(runs[0].Font, "AdobeBlank2") {
+		t.Errorf("expected the text to be drawn with the family font, got %+v", runs)
+	}
+}
+
+func TestLoadFontManifest(t *testing.T) {
+	font, err := filepath.Abs("./testdata/fonts/AdobeBlank2.ttf")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		manifest string
+		valid    bool
+	}{{
+		name:     "valid",
+		manifest: `{"families": [{"name": "Test Manifest", "fallback": ["Symbola"], "fonts": [{"file": %q, "weight": "bold"}]}]}`,
+		valid:    true,
+	}, {
+		name:     "unknown fallback",
+		manifest: `{"families": [{"name": "Test Manifest", "fallback": ["Comic Sans"], "fonts": [{"file": %q}]}]}`,
+	}, {
+		name:     "invalid weight",
+		manifest: `{"families": [{"name": "Test Manifest", "fonts": [{"file": %q, "weight": "heavy"}]}]}`,
+	}, {
+		name:     "missing file",
+		manifest: `{"families": [{"name": "Test Manifest", "fonts": [{"file": "%s.missing"}]}]}`,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FontManifest)
+
+			if err := os.WriteFile(path, []byte(fmt.Sprintf(tt.manifest, font)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { unregisterFamily("Test Manifest") })
+
+			found, err := LoadFontManifest(path)
+
+			if !tt.valid {
+				if err == nil {
+					t.Error("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil || found != 1 {
+				t.Fatalf("expected one font registered, got %d (%v)", found, err)
+			}
+
+			chain, err := resolveChain("Test Manifest", WeightBold, StyleNormal)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if chain.primary.weight != WeightBold || len(chain.fallback) != 1 || chain.fallback[0].name != "Symbola" {
+				t.Errorf("expected the bold font falling back to Symbola, got %+v", chain)
+			}
+		})
+	}
+}
+
+func TestLoadFont_Pool(t *testing.T) {
+	spec := newFontSpec("", 0, "", 41)
+	face1, err := loadFont(spec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	face2, err := loadFont(spec)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if face1 == face2 {
+		t.Error("expected a face not to be shared until it's released")
+	}
+
+	releaseFont(spec, face1)
+	releaseFont(spec, face2)
+}
+
+func TestNewFontSpec_Size(t *testing.T) {
+	testCases := []struct {
+		name     string
+		size     float64
+		expected float64
+	}{{
+		name:     "integer",
+		size:     42,
+		expected: 42,
+	}, {
+		name:     "fraction",
+		size:     41.6,
+		expected: 42,
+	}, {
+		name:     "too small",
+		size:     0.2,
+		expected: minFontSize,
+	}, {
+		name:     "too large",
+		size:     4000,
+		expected: maxFontSize,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if spec := newFontSpec("", 0, "", tt.size); spec.size != tt.expected {
+				t.Errorf("expected size %v, got %v", tt.expected, spec.size)
+			}
+		})
+	}
+}
+
+func TestFacesOf_Evict(t *testing.T) {
+	first := newFontSpec("", WeightRegular, StyleItalic, minFontSize)
+	facesOf(first)
+
+	for i := 0; i < maxFacePools; i++ {
+		facesOf(newFontSpec("", Weight(100+i/int(maxFontSize)*100), StyleItalic, float64(1+i%int(maxFontSize))))
+	}
+
+	faces.Lock()
+	defer faces.Unlock()
+
+	if n := faces.recent.Len(); n != maxFacePools || len(faces.pools) != n {
+		t.Errorf("expected %d face pools, got %d", maxFacePools, n)
+	}
+
+	if _, ok := faces.pools[first]; ok {
+		t.Error("expected the least recently used face pool to be evicted")
+	}
+}
+
+func TestMeasure_Concurrent(t *testing.T) {
+	expected := newTestPreview(t, 42).measure("The quick brown fox ★")
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		p := newTestPreview(t, 42)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer p.releaseFonts()
+
+			for j := 0; j < 20; j++ {
+				if w := p.measure("The quick brown fox ★"); w != expected {
+					t.Errorf("expected width %v, got %v", expected, w)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestMissingGlyphs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []rune
+	}{{
+		name:     "all covered",
+		text:     "The quick brown fox ★ 🔥👍🏽",
+		expected: []rune{},
+	}, {
+		name:     "ethiopic",
+		text:     "Ethiopic ሀ ሀ",
+		expected: []rune{'ሀ'},
+	}, {
+		name:     "sinhala after arabic",
+		text:     "مرحبا ක",
+		expected: []rune{'ක'},
+	}}
+
+	p := newTestPreview(t, 40)
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := p.missingGlyphs(tt.text); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("%q: expected %q, got %q", tt.text, tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package preview
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// AvaGenerator is a kind of the avatar generated from the author name instead of fetching one.
+type AvaGenerator string
+
+// Avatar generators, the zero value fetches the avatar by its URL
+const (
+	AvaFetched   AvaGenerator = ""
+	AvaInitials  AvaGenerator = "initials"
+	AvaIdenticon AvaGenerator = "identicon"
+)
+
+const (
+	// initialsSize is the font size of the initials relative to the avatar size
+	initialsSize = 0.4
+	// identiconCells is the number of the identicon cells across, the left half is mirrored to the right one
+	identiconCells = 5
+	// identiconBg is the background color of the identicon
+	identiconBg = "#F0F0F0"
+)
+
+// drawGeneratedAvatar draws the i-th avatar of the stack generated from the author name, the same name always
+// gets the same one.
+func (p *Preview) drawGeneratedAvatar(ctx context.Context, author Author, i int) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawGeneratedAvatar")
+
+	defer func() { tracing.End(span, err) }()
+
+	startedAt := time.Now()
+	sum := sha1.Sum([]byte(author.Name))
+	var img image.Image
+
+	switch author.AvaGenerator {
+	case AvaIdenticon:
+		img = identicon(sum, p.opts.AvaD)
+	default:
+		if img, err = p.initialsAvatar(author.Name, sum); err != nil {
+			return err
+		}
+	}
+
+	p.report.timing("generate", avatarKey(i), startedAt)
+
+	avaX, avaY := p.avatarCenter(i)
+
+	p.drawAvatarImage(img, avaX, avaY)
+
+	return nil
+}
+
+// initialsAvatar draws the initials of the name over the color of its hash.
+func (p *Preview) initialsAvatar(name string, sum [sha1.Size]byte) (image.Image, error) {
+	d := p.opts.AvaD
+	bg := nameColor(sum, 0.55, 0.45)
+	// the text is white unless the black one contrasts better with the color
+	text := color.Color(color.White)
+
+	if contrastRatio(luminance(bg), 0) > contrastRatio(luminance(bg), 1) {
+		text = color.Black
+	}
+
+	// the initials are drawn with the text machinery on a layer of the avatar size
+	canvas := p.ctx
+	p.ctx = gg.NewContext(d, d)
+
+	defer func() { p.ctx = canvas }()
+
+	p.ctx.SetColor(bg)
+	p.ctx.Clear()
+
+	spec := p.authorFont()
+	spec.size = math.Round(float64(d) * initialsSize)
+
+	if err := p.setFont(spec); err != nil {
+		return nil, err
+	}
+
+	p.setColor(text)
+
+	s := initials(name, p.opts.Lang)
+
+	// centered like gg.Context.DrawStringAnchored does
+	p.drawText(s, (float64(d)-p.measure(s))/2, (float64(d)+p.ctx.FontHeight())/2)
+
+	return p.ctx.Image(), nil
+}
+
+// identicon draws the symmetric grid of cells switched on by the bits of the name hash in the color of the hash.
+func identicon(sum [sha1.Size]byte, d int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, d, d))
+	bg, _ := ParseColor(identiconBg)
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	// the grid is inset by half a cell, the cells are whole pixels to keep the edges sharp
+	cell := d / (identiconCells + 1)
+	inset := (d - cell*identiconCells) / 2
+	fg := image.NewUniform(nameColor(sum, 0.6, 0.55))
+	half := (identiconCells + 1) / 2
+
+	for col := 0; col < half; col++ {
+		for row := 0; row < identiconCells; row++ {
+			if sum[col*identiconCells+row]&1 == 1 {
+				continue
+			}
+
+			for _, c := range []int{col, identiconCells - 1 - col} {
+				r := image.Rect(0, 0, cell, cell).Add(image.Pt(inset+c*cell, inset+row*cell))
+
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return img
+}
+
+// initials returns the first letters of the first and the last words of the name in uppercase,
+// e.g. JD for John Doe or D for @dmitry.
+func initials(name, lang string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	if len(words) == 0 {
+		return ""
+	}
+
+	first := func(word string) string {
+		cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(word, -1)
+
+		return cluster
+	}
+
+	s := first(words[0])
+
+	if len(words) > 1 {
+		s += first(words[len(words)-1])
+	}
+
+	return cases.Upper(language.Make(lang)).String(s)
+}
+
+// nameColor returns the color of the hue picked by the last bytes of the name hash with the HSL saturation
+// and lightness.
+func nameColor(sum [sha1.Size]byte, s, l float64) color.NRGBA {
+	h := float64(binary.BigEndian.Uint16(sum[sha1.Size-2:])) / (math.MaxUint16 + 1) * 6
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+
+	switch int(h) {
+	case 0:
+		r, g = chroma, x
+	case 1:
+		r, g = x, chroma
+	case 2:
+		g, b = chroma, x
+	case 3:
+		g, b = x, chroma
+	case 4:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+
+	m := l - chroma/2
+	channel := func(v float64) uint8 {
+		return uint8(math.Round((v + m) * 255))
+	}
+
+	return color.NRGBA{R: channel(r), G: channel(g), B: channel(b), A: 255}
+}
@@ -0,0 +1,63 @@
+package preview
+
+import (
+	"crypto/sha1"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	testCases := []struct {
+		name, lang, expected string
+	}{{
+		name:     "Jane Doe",
+		expected: "JD",
+	}, {
+		name:     "@dmitry",
+		expected: "D",
+	}, {
+		name:     "jean-luc de la Picard",
+		expected: "JP",
+	}, {
+		name:     "ilker",
+		lang:     "tr",
+		expected: "İ",
+	}, {
+		name:     "🙂",
+		expected: "",
+	}, {
+		name:     "",
+		expected: "",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := initials(tt.name, tt.lang); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIdenticon(t *testing.T) {
+	const d = 60
+
+	a := identicon(sha1.Sum([]byte("@alice")), d).(*image.NRGBA)
+
+	if !reflect.DeepEqual(a, identicon(sha1.Sum([]byte("@alice")), d)) {
+		t.Error("expected the same identicon for the same name")
+	}
+
+	if reflect.DeepEqual(a, identicon(sha1.Sum([]byte("@bob")), d)) {
+		t.Error("expected different identicons for different names")
+	}
+
+	for y := 0; y < d; y++ {
+		for x := 0; x < d/2; x++ {
+			if a.NRGBAAt(x, y) != a.NRGBAAt(d-1-x, y) {
+				t.Fatalf("expected the identicon to be symmetric, %d,%d differs", x, y)
+			}
+		}
+	}
+}
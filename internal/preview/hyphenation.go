@@ -0,0 +1,277 @@
+package preview
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	// hyphen is drawn at the end of lines broken inside a word
+	hyphen = "-"
+	// balanceSteps is the number of the binary search steps of the balanced line width
+	balanceSteps = 8
+)
+
+//go:embed hyphenation/hyph-*.txt
+var patterns embed.FS
+
+// hyphenation is a set of Liang's hyphenation patterns and exceptions of a language loaded on demand.
+type hyphenation struct {
+	file string
+	// the minimal number of letters before and after a break
+	leftMin, rightMin int
+	once              sync.Once
+	// letters of the patterns mapped to the priorities of the breaks around them
+	patterns   map[string][]uint8
+	maxLen     int
+	exceptions map[string][]int
+	err        error
+}
+
+// hyphenations are the pattern sets by the base language
+var hyphenations = map[string]*hyphenation{
+	"en": {file: "hyph-en-us", leftMin: 2, rightMin: 3},
+	"de": {file: "hyph-de-1996", leftMin: 2, rightMin: 2},
+	"ru": {file: "hyph-ru", leftMin: 2, rightMin: 2},
+	"fr": {file: "hyph-fr", leftMin: 2, rightMin: 3},
+	"es": {file: "hyph-es", leftMin: 2, rightMin: 2},
+}
+
+// ParseLang parses a BCP 47 language tag, e.g. en, de-AT or ru, and returns it in the canonical form.
+func ParseLang(s string) (string, error) {
+	tag, err := language.Parse(s)
+
+	if err != nil {
+		return "", err
+	}
+
+	return tag.String(), nil
+}
+
+// hyphenationFor returns the hyphenation patterns of the language or nil if there are none.
+func hyphenationFor(lang string) *hyphenation {
+	if lang == "" {
+		return nil
+	}
+
+	tag, err := language.Parse(lang)
+
+	if err != nil {
+		return nil
+	}
+
+	base, _ := tag.Base()
+
+	return hyphenations[base.String()]
+}
+
+// load parses the patterns and the exceptions once.
+func (h *hyphenation) load() error {
+	h.once.Do(func() {
+		if h.err = h.parse(); h.err != nil {
+			slog.Warn("could not load hyphenation patterns", "file", h.file, "error", h.err)
+		}
+	})
+
+	return h.err
+}
+
+func (h *hyphenation) parse() error {
+	h.patterns = map[string][]uint8{}
+	h.exceptions = map[string][]int{}
+
+	err := readLines(h.file+".pat.txt", func(line string) {
+		letters, priorities := []rune{}, []uint8{0}
+
+		for _, r := range line {
+			if r >= '0' && r <= '9' {
+				priorities[len(priorities)-1] = uint8(r - '0')
+			} else {
+				letters = append(letters, r)
+				priorities = append(priorities, 0)
+			}
+		}
+
+		h.patterns[string(letters)] = priorities
+		h.maxLen = max(h.maxLen, len(letters))
+	})
+
+	if err != nil {
+		return fmt.Errorf("could not read the patterns: %w", err)
+	}
+
+	err = readLines(h.file+".hyp.txt", func(line string) {
+		breaks := []int{}
+
+		for i, part := range strings.Split(line, hyphen) {
+			if i > 0 {
+				breaks = append(breaks, breaks[len(breaks)-1]+utf8.RuneCountInString(part))
+			} else {
+				breaks = append(breaks, utf8.RuneCountInString(part))
+			}
+		}
+
+		h.exceptions[strings.ReplaceAll(line, hyphen, "")] = breaks[:len(breaks)-1]
+	})
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read the exceptions: %w", err)
+	}
+
+	return nil
+}
+
+// readLines calls f for each non-empty line of the embedded patterns file.
+func readLines(name string, f func(line string)) error {
+	file, err := patterns.Open("hyphenation/" + name)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			f(line)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// breaks returns the rune offsets within the lowercase word where it can be hyphenated.
+func (h *hyphenation) breaks(word string) []int {
+	if breaks, ok := h.exceptions[word]; ok {
+		return breaks
+	}
+
+	letters := []rune("." + word + ".")
+	priorities := make([]uint8, len(letters)+1)
+
+	for i := range letters {
+		for j := i + 1; j <= len(letters) && j-i <= h.maxLen; j++ {
+			for k, p := range h.patterns[string(letters[i:j])] {
+				priorities[i+k] = max(priorities[i+k], p)
+			}
+		}
+	}
+
+	breaks := []int{}
+	n := len(letters) - 2
+
+	// odd priorities allow a break, the ones before the letters of the word are shifted by the leading dot
+	for i := h.leftMin; i <= n-h.rightMin; i++ {
+		if priorities[i+1]%2 == 1 {
+			breaks = append(breaks, i)
+		}
+	}
+
+	return breaks
+}
+
+// hyphenate returns the byte offsets within the word where it can be hyphenated.
+// Only the letters are hyphenated, leading and trailing punctuation is kept, and words with other characters aren't.
+func (h *hyphenation) hyphenate(word string) []int {
+	start := strings.IndexFunc(word, unicode.IsLetter)
+	end := strings.LastIndexFunc(word, unicode.IsLetter)
+
+	if start < 0 || h.load() != nil {
+		return nil
+	}
+
+	_, size := utf8.DecodeRuneInString(word[end:])
+	core := word[start : end+size]
+
+	if strings.IndexFunc(core, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+		return nil
+	}
+
+	offsets := []int{}
+	runes := 0
+	breaks := h.breaks(strings.ToLower(core))
+
+	for i := range core {
+		if len(breaks) > 0 && breaks[0] == runes {
+			offsets = append(offsets, start+i)
+			breaks = breaks[1:]
+		}
+
+		runes++
+	}
+
+	return offsets
+}
+
+// hyphenation returns the hyphenation patterns of the title language, or nil when the title isn't hyphenated.
+func (p *Preview) hyphenation() *hyphenation {
+	if p.opts == nil {
+		return nil
+	}
+
+	return hyphenationFor(p.opts.Lang)
+}
+
+// hyphenateLine breaks the word at the last hyphenation point after the from offset at which the line followed
+// by the part of the word and a hyphen fits the width. It returns the line with the hyphen and the offset of the rest.
+func (p *Preview) hyphenateLine(line, word richText, from int, width float64) (richText, int, bool) {
+	h := p.hyphenation()
+
+	if h == nil {
+		return richText{}, 0, false
+	}
+
+	offsets := h.hyphenate(word.text)
+
+	for i := len(offsets) - 1; i >= 0 && offsets[i] > from; i-- {
+		head := word.slice(from, offsets[i])
+		hyphenated := line.concat(head).append(hyphen, head.lastMark())
+
+		if p.measureRich(hyphenated) <= width {
+			return hyphenated, offsets[i], true
+		}
+	}
+
+	return richText{}, 0, false
+}
+
+// balance wraps the text to the same number of lines as wrap does but to the narrowest width possible,
+// so that the lines are about the same width instead of a short last line.
+func (p *Preview) balance(text richText, width float64) []richText {
+	lines, _ := p.wrapLines(text, width, p.opts.MaxLines)
+
+	if len(lines) < 2 || (p.opts.MaxLines > 0 && len(lines) > p.opts.MaxLines) {
+		return lines
+	}
+
+	lo, hi := 0.0, width
+
+	for _, line := range lines {
+		lo += p.measureRich(line) / float64(len(lines))
+	}
+
+	for i := 0; i < balanceSteps; i++ {
+		mid := (lo + hi) / 2
+
+		// words must not be broken to make the lines narrower
+		if narrow, broken := p.wrapLines(text, mid, len(lines)); len(narrow) == len(lines) && !broken {
+			lines, hi = narrow, mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,147 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHyphenate(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		lang, word, expected string
+	}{{
+		name:     "english",
+		lang:     "en",
+		word:     "hyphenation",
+		expected: "hy-phen-a-tion",
+	}, {
+		name:     "british english",
+		lang:     "en-GB",
+		word:     "Typography",
+		expected: "Ty-pog-ra-phy",
+	}, {
+		name:     "single letter syllable",
+		lang:     "en",
+		word:     "academy",
+		expected: "acad-e-my",
+	}, {
+		name:     "no breaks",
+		lang:     "en",
+		word:     "project",
+		expected: "project",
+	}, {
+		name:     "german with punctuation",
+		lang:     "de",
+		word:     "(Silbentrennung),",
+		expected: "(Sil-ben-tren-nung),",
+	}, {
+		name:     "austrian german compound",
+		lang:     "de-AT",
+		word:     "Donaudampfschifffahrtsgesellschaft",
+		expected: "Do-nau-dampf-schiff-fahrts-ge-sell-schaft",
+	}, {
+		name:     "russian",
+		lang:     "ru",
+		word:     "достопримечательность",
+		expected: "до-сто-при-ме-ча-тель-ность",
+	}, {
+		name:     "french",
+		lang:     "fr",
+		word:     "anticonstitutionnellement",
+		expected: "an-ti-cons-ti-tu-tion-nel-le-ment",
+	}, {
+		name:     "spanish",
+		lang:     "es",
+		word:     "electroencefalografista",
+		expected: "elec-tro-en-ce-fa-lo-gra-fis-ta",
+	}, {
+		name:     "digits",
+		lang:     "en",
+		word:     "abc123def",
+		expected: "abc123def",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			h := hyphenationFor(tt.lang)
+
+			if h == nil {
+				t.Fatalf("%s: expected the hyphenation patterns", tt.lang)
+			}
+
+			actual := tt.word
+
+			offsets := h.hyphenate(tt.word)
+
+			for i := len(offsets) - 1; i >= 0; i-- {
+				actual = actual[:offsets[i]] + hyphen + actual[offsets[i]:]
+			}
+
+			if actual != tt.expected {
+				t.Errorf("%s: expected %q, got %q", tt.lang, tt.expected, actual)
+			}
+		})
+	}
+
+	if h := hyphenationFor("ja"); h != nil {
+		t.Errorf("expected no hyphenation patterns for Japanese, got %s", h.file)
+	}
+}
+
+func TestWrap_Hyphenation(t *testing.T) {
+	text := "Die Donaudampfschifffahrtsgesellschaft und die Rechtsschutzversicherungsgesellschaften"
+	width := 200.0
+	p := newTestPreview(t, 20)
+	p.opts.Lang = "de"
+	lines, broken := p.wrapLines(plain(text), width, 0)
+
+	if broken || len(lines) < 3 {
+		t.Fatalf("the words are expected to be hyphenated: %q", texts(lines))
+	}
+
+	joined := ""
+
+	for _, line := range lines {
+		if w := p.measureRich(line); w > width {
+			t.Errorf("the line is wider than %v: %q (%v)", width, line.text, w)
+		}
+
+		if strings.HasSuffix(line.text, hyphen) {
+			joined += strings.TrimSuffix(line.text, hyphen)
+		} else {
+			joined += line.text + " "
+		}
+	}
+
+	if joined = strings.TrimSpace(joined); joined != text {
+		t.Errorf("expected the lines to keep the text, got %q", joined)
+	}
+}
+
+func TestBalance(t *testing.T) {
+	title := plain("The quick brown fox jumps over the lazy dog")
+	p := newTestPreview(t, 20)
+	// the last line of the wrapped title is a single word
+	width := p.measure("The quick brown fox jumps over the lazy") + 1
+	wrapped := p.wrap(title, width, 0)
+	balanced := p.balance(title, width)
+
+	if len(balanced) != len(wrapped) {
+		t.Fatalf("expected %d balanced lines, got %q", len(wrapped), texts(balanced))
+	}
+
+	spread := func(lines []richText) float64 {
+		lo, hi := width, 0.0
+
+		for _, line := range lines {
+			w := p.measureRich(line)
+			lo, hi = min(lo, w), max(hi, w)
+		}
+
+		return hi - lo
+	}
+
+	if spread(balanced) >= spread(wrapped) {
+		t.Errorf("expected the balanced lines %q to be more even than %q", texts(balanced), texts(wrapped))
+	}
+}
@@ -0,0 +1,442 @@
+package preview
+
+import (
+	"image/color"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// markup is a set of inline styles of a part of the title.
+type markup uint8
+
+const (
+	markBold markup = 1 << iota
+	markHighlight
+	markCode
+)
+
+const (
+	// codeFamily is the monospace font family of code spans
+	codeFamily = "Go Mono"
+	// boxPadding is the padding of highlight and code backgrounds relative to the font size
+	boxPadding = 0.15
+	// boxRadius is the corner radius of highlight and code backgrounds relative to the font size
+	boxRadius = 0.12
+	// escapable lists the characters a backslash escapes
+	escapable = "\\*=`"
+)
+
+var (
+	highlightBgColor   = color.RGBA{R: 255, G: 212, B: 59, A: 255}
+	highlightTextColor = color.RGBA{R: 26, G: 26, B: 26, A: 255}
+	// translucent white, the color is premultiplied by alpha
+	codeBgColor = color.RGBA{R: 48, G: 48, B: 48, A: 48}
+)
+
+// markers lists the inline markup markers and the styles they toggle.
+var markers = []struct {
+	token string
+	mark  markup
+}{
+	{"==", markHighlight},
+	{"*", markBold},
+	{"`", markCode},
+}
+
+// richText is a text with the inline styles of each of its bytes.
+type richText struct {
+	text  string
+	marks []markup
+}
+
+// span is a part of a text drawn with the same inline styles.
+type span struct {
+	text string
+	mark markup
+}
+
+// plain returns the text without inline styles.
+func plain(text string) richText {
+	return richText{text: text, marks: make([]markup, len(text))}
+}
+
+// parseMarkup parses the inline markup: *bold*, ==highlight== and `code`. A marker opens a span only when it's
+// followed by a non-space and the same marker preceded by a non-space closes it later, otherwise it's a literal.
+// Markers are literals inside code spans. A backslash escapes the markers and itself.
+func parseMarkup(text string) richText {
+	closers := lastClosers(text)
+	b := strings.Builder{}
+	marks := make([]markup, 0, len(text))
+	active := markup(0)
+
+	b.Grow(len(text))
+
+	for i := 0; i < len(text); {
+		if text[i] == '\\' && i+1 < len(text) && strings.IndexByte(escapable, text[i+1]) >= 0 {
+			b.WriteByte(text[i+1])
+			marks = append(marks, active)
+			i += 2
+
+			continue
+		}
+
+		if mark, n, ok := marker(text, i, active, closers); ok {
+			active ^= mark
+			i += n
+
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+
+		for j := 0; j < size; j++ {
+			marks = append(marks, active)
+		}
+
+		i += size
+	}
+
+	return richText{text: b.String(), marks: marks}
+}
+
+// marker reports whether a marker opening or closing a span starts at i.
+// The closers are the positions of the last marker candidates that can close a span.
+func marker(text string, i int, active markup, closers []int) (markup, int, bool) {
+	for k, m := range markers {
+		if !strings.HasPrefix(text[i:], m.token) {
+			continue
+		}
+
+		if active&m.mark != 0 {
+			prev, _ := utf8.DecodeLastRuneInString(text[:i])
+
+			return m.mark, len(m.token), !unicode.IsSpace(prev)
+		}
+
+		if active&markCode != 0 {
+			return 0, 0, false
+		}
+
+		next, _ := utf8.DecodeRuneInString(text[i+len(m.token):])
+
+		if next == utf8.RuneError || unicode.IsSpace(next) || closers[k] <= i+len(m.token) {
+			return 0, 0, false
+		}
+
+		return m.mark, len(m.token), true
+	}
+
+	return 0, 0, false
+}
+
+// lastClosers returns the position of the last unescaped occurrence of each marker preceded by a non-space,
+// or -1 if there is none. An opener is only a marker if such an occurrence follows it, so one pass over
+// the text answers that for every opener.
+func lastClosers(text string) []int {
+	closers := make([]int, len(markers))
+
+	for k, m := range markers {
+		closers[k] = -1
+
+		for i := strings.LastIndex(text, m.token); i > 0; i = strings.LastIndex(text[:i+len(m.token)-1], m.token) {
+			if text[i-1] == '\\' {
+				continue
+			}
+
+			if prev, _ := utf8.DecodeLastRuneInString(text[:i]); !unicode.IsSpace(prev) {
+				closers[k] = i
+
+				break
+			}
+		}
+	}
+
+	return closers
+}
+
+// append returns the rich text followed by the text in the style.
+func (rt richText) append(text string, mark markup) richText {
+	other := plain(text)
+
+	for i := range other.marks {
+		other.marks[i] = mark
+	}
+
+	return rt.concat(other)
+}
+
+// concat returns the rich text followed by the other one.
+func (rt richText) concat(other richText) richText {
+	marks := make([]markup, 0, len(rt.marks)+len(other.marks))
+	marks = append(append(marks, rt.marks...), other.marks...)
+
+	return richText{text: rt.text + other.text, marks: marks}
+}
+
+// join joins the rich texts with the separator without styles.
+func join(rts []richText, sep string) richText {
+	result := richText{}
+
+	for i, rt := range rts {
+		if i > 0 {
+			result = result.append(sep, 0)
+		}
+
+		result = result.concat(rt)
+	}
+
+	return result
+}
+
+// slice returns the part of the rich text between the byte offsets.
+func (rt richText) slice(i, j int) richText {
+	return richText{text: rt.text[i:j], marks: rt.marks[i:j]}
+}
+
+// lastMark returns the style of the last byte or no style for an empty text.
+func (rt richText) lastMark() markup {
+	if len(rt.marks) == 0 {
+		return 0
+	}
+
+	return rt.marks[len(rt.marks)-1]
+}
+
+// trimRightFunc returns the rich text with the trailing runes satisfying f cut off.
+func (rt richText) trimRightFunc(f func(rune) bool) richText {
+	return rt.slice(0, len(strings.TrimRightFunc(rt.text, f)))
+}
+
+// trimSpace returns the rich text without the leading and trailing spaces.
+func (rt richText) trimSpace() richText {
+	start := len(rt.text) - len(strings.TrimLeftFunc(rt.text, unicode.IsSpace))
+
+	return rt.slice(start, len(rt.text)).trimRightFunc(unicode.IsSpace)
+}
+
+// spans splits the rich text into parts of the same styles.
+func (rt richText) spans() []span {
+	spans := []span{}
+	start := 0
+
+	for i := 1; i <= len(rt.text); i++ {
+		if i == len(rt.text) || rt.marks[i] != rt.marks[start] {
+			spans = append(spans, span{text: rt.text[start:i], mark: rt.marks[start]})
+			start = i
+		}
+	}
+
+	return spans
+}
+
+// styled reports whether any part of the text has inline styles.
+func (rt richText) styled() bool {
+	for _, m := range rt.marks {
+		if m != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// texts returns the texts of the rich texts.
+func texts(rts []richText) []string {
+	result := make([]string, 0, len(rts))
+
+	for _, rt := range rts {
+		result = append(result, rt.text)
+	}
+
+	return result
+}
+
+// styledSpans returns the spans of the rich text as reported in the debug mode, or nil for a text without styles.
+func (rt richText) styledSpans() []StyledSpan {
+	if !rt.styled() {
+		return nil
+	}
+
+	result := []StyledSpan{}
+
+	for _, s := range rt.spans() {
+		result = append(result, StyledSpan{Text: s.text, Styles: s.mark.styleNames()})
+	}
+
+	return result
+}
+
+// styleNames returns the names of the styles reported in the debug mode.
+func (m markup) styleNames() []string {
+	names := []string{}
+
+	if m&markBold != 0 {
+		names = append(names, "bold")
+	}
+
+	if m&markHighlight != 0 {
+		names = append(names, "highlight")
+	}
+
+	if m&markCode != 0 {
+		names = append(names, "code")
+	}
+
+	return names
+}
+
+// boxed reports whether the span is drawn on a background box.
+func (m markup) boxed() bool {
+	return m&(markHighlight|markCode) != 0
+}
+
+// font returns the font spec of the span style based on the spec of the plain text.
+func (m markup) font(base fontSpec) fontSpec {
+	spec := base
+
+	if m&markBold != 0 {
+		spec.weight = WeightBold
+
+		if base.weight >= WeightBold {
+			spec.weight = 900
+		}
+	}
+
+	if m&markCode != 0 {
+		spec.family = codeFamily
+	}
+
+	return spec
+}
+
+// withMark calls f with the font of the span style and sets the font of the plain text back.
+// The style fonts are the embedded ones or the title family ones, so they only fail to load along with the title font.
+func (p *Preview) withMark(mark markup, f func()) {
+	if mark == 0 {
+		f()
+		return
+	}
+
+	base := p.spec
+
+	if err := p.setFont(mark.font(base)); err == nil {
+		defer p.setFont(base)
+	}
+
+	f()
+}
+
+// spanWidth returns the width of the span drawn with its style including the background box padding.
+func (p *Preview) spanWidth(s span) float64 {
+	w := 0.0
+
+	p.withMark(s.mark, func() { w = p.measure(s.text) })
+
+	if s.mark.boxed() {
+		w += 2 * p.fontSize * boxPadding
+	}
+
+	return w
+}
+
+// measureRich returns the width of the rich text drawn with the current font face and the span styles.
+func (p *Preview) measureRich(rt richText) float64 {
+	w := 0.0
+
+	for _, s := range rt.spans() {
+		w += p.spanWidth(s)
+	}
+
+	return w
+}
+
+// richGlyphRuns splits the rich text into runs of characters drawn with the same font of the span style font chains.
+func (p *Preview) richGlyphRuns(rt richText) ([]GlyphRun, error) {
+	runs := []GlyphRun{}
+
+	for _, s := range rt.spans() {
+		var spanRuns []GlyphRun
+		var err error
+
+		p.withMark(s.mark, func() { spanRuns, err = p.glyphRuns(s.text) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, run := range spanRuns {
+			if n := len(runs); n > 0 && runs[n-1].Font == run.Font {
+				runs[n-1].Text += run.Text
+			} else {
+				runs = append(runs, run)
+			}
+		}
+	}
+
+	return runs, nil
+}
+
+// drawRich draws the rich text on the baseline starting at x: the backgrounds of highlight and code spans first,
+// then the text of each span with its font and color. Spans of right-to-left text are placed from right to left.
+func (p *Preview) drawRich(rt richText, x, baseline float64) {
+	spans := rt.spans()
+
+	if len(spans) == 1 && spans[0].mark == 0 {
+		p.drawText(spans[0].text, x, baseline)
+		return
+	}
+
+	if isRTL(rt.text) {
+		for l, r := 0, len(spans)-1; l < r; l, r = l+1, r-1 {
+			spans[l], spans[r] = spans[r], spans[l]
+		}
+	}
+
+	xs := make([]float64, len(spans))
+	widths := make([]float64, len(spans))
+
+	for i, s := range spans {
+		xs[i], widths[i] = x, p.spanWidth(s)
+		x += widths[i]
+	}
+
+	metrics := p.face.Metrics()
+	pad := p.fontSize * boxPadding
+	top := baseline - float64(metrics.Ascent)/64 - pad/2
+	height := float64(metrics.Ascent+metrics.Descent)/64 + pad
+	textColor := p.color
+
+	for i, s := range spans {
+		if !s.mark.boxed() {
+			continue
+		}
+
+		p.ctx.SetColor(codeBgColor)
+
+		if s.mark&markHighlight != 0 {
+			p.ctx.SetColor(highlightBgColor)
+		}
+
+		p.ctx.DrawRoundedRectangle(xs[i], top, widths[i], height, p.fontSize*boxRadius)
+		p.ctx.Fill()
+	}
+
+	p.setColor(textColor)
+
+	for i, s := range spans {
+		textX := xs[i]
+
+		if s.mark.boxed() {
+			textX += pad
+		}
+
+		if s.mark&markHighlight != 0 {
+			p.setColor(highlightTextColor)
+		}
+
+		p.withMark(s.mark, func() { p.drawText(s.text, textX, baseline) })
+		p.setColor(textColor)
+	}
+}
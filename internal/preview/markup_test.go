@@ -0,0 +1,117 @@
+package preview
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkup(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []span
+	}{{
+		name:     "plain",
+		text:     "The quick brown fox",
+		expected: []span{{"The quick brown fox", 0}},
+	}, {
+		name:     "styles",
+		text:     "The *quick* ==brown== `fox`",
+		expected: []span{{"The ", 0}, {"quick", markBold}, {" ", 0}, {"brown", markHighlight}, {" ", 0}, {"fox", markCode}},
+	}, {
+		name:     "nested",
+		text:     "==very *bold* highlight==",
+		expected: []span{{"very ", markHighlight}, {"bold", markHighlight | markBold}, {" highlight", markHighlight}},
+	}, {
+		name:     "escapes",
+		text:     "2 \\* 3 \\=\\= 6 \\\\ \\`x\\`",
+		expected: []span{{"2 * 3 == 6 \\ `x`", 0}},
+	}, {
+		name:     "unclosed",
+		text:     "*quick brown",
+		expected: []span{{"*quick brown", 0}},
+	}, {
+		name:     "spaced",
+		text:     "2 * 3 * 4 and a* b",
+		expected: []span{{"2 * 3 * 4 and a* b", 0}},
+	}, {
+		name:     "code literal",
+		text:     "`a *b* c` *d*",
+		expected: []span{{"a *b* c", markCode}, {" ", 0}, {"d", markBold}},
+	}, {
+		name:     "escaped closer",
+		text:     "*quick\\* brown",
+		expected: []span{{"*quick* brown", 0}},
+	}, {
+		name:     "overlapping closer",
+		text:     "==quick=== brown",
+		expected: []span{{"quick", markHighlight}, {"= brown", 0}},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := parseMarkup(tt.text).spans(); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWrap_Markup(t *testing.T) {
+	p := newTestPreview(t, 20)
+	title := parseMarkup("The *quick brown* fox ==jumps over the lazy dog== and `runs` away")
+	width := 120.0
+	lines := p.wrap(title, width, 0)
+
+	if len(lines) < 3 {
+		t.Fatalf("the text is expected to be broken: %q", texts(lines))
+	}
+
+	for _, line := range lines {
+		if w := p.measureRich(line); w > width {
+			t.Errorf("the line is wider than %v: %q (%v)", width, line.text, w)
+		}
+	}
+
+	joined := join(lines, " ")
+
+	if joined.text != title.text {
+		t.Fatalf("expected the lines to keep the text, got %q", texts(lines))
+	}
+
+	// the styles are kept across the line breaks
+	for i, m := range joined.marks {
+		if joined.text[i] != ' ' && m != title.marks[i] {
+			t.Errorf("expected the style %v at %d, got %v: %+v", title.marks[i], i, m, joined.spans())
+			break
+		}
+	}
+
+	if p.measureRich(parseMarkup("`fox`")) <= p.measure("fox") {
+		t.Error("expected a code span to be wider than the plain text")
+	}
+}
+
+func TestTruncate_Markup(t *testing.T) {
+	p := newTestPreview(t, 20)
+	p.opts.MaxLines = 1
+	width := 200.0
+	lines, truncated := p.truncate(p.wrap(parseMarkup(strings.Repeat("==highlighted== ", 10)), width, 0), width)
+
+	if !truncated || len(lines) != 1 {
+		t.Fatalf("the text is expected to be truncated to one line: %q", texts(lines))
+	}
+
+	if spans := lines[0].spans(); spans[len(spans)-1].mark != markHighlight {
+		t.Errorf("expected the ellipsis to keep the style of the last span: %+v", spans)
+	}
+}
+
+func BenchmarkParseMarkup(b *testing.B) {
+	title := strings.Repeat("The *quick* brown ==fox== jumps over the `lazy` dog ", 1000)
+
+	for n := 0; n < b.N; n++ {
+		parseMarkup(title)
+	}
+}
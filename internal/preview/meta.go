@@ -0,0 +1,237 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nDmitry/ogimgd/internal/tracing"
+)
+
+const (
+	// metaSeparator joins the items of the metadata line
+	metaSeparator = " · "
+	// metaDate is the layout of the publish date on the metadata line
+	metaDate = "Jan 2, 2006"
+	// chipPadding is the horizontal padding of the tag text in its chip relative to the font size
+	chipPadding = 0.6
+	// chipHeight is the height of a tag chip relative to the font size
+	chipHeight = 1.6
+	// chipGap is the gap between the tag chips relative to the font size
+	chipGap = 0.4
+	// chipOpacity is the opacity of the chip background of the title color
+	chipOpacity = 0.2
+	// subtitleGap is the gap between the title and the subtitle
+	subtitleGap = padding / 2
+)
+
+// Meta is the metadata line and the tags drawn in the logo row left of the logo. Zero values are not drawn.
+type Meta struct {
+	// Publish date
+	Date time.Time `json:"date"`
+	// Reading time in minutes
+	ReadingTime int    `json:"readingTime"`
+	Category    string `json:"category"`
+	// Tags drawn as chips with rounded backgrounds
+	Tags []string `json:"tags"`
+	// Font size of the metadata line and the tags
+	Size float64 `json:"size"`
+}
+
+// items returns the items of the metadata line: the date, the reading time and the category.
+func (m Meta) items() []string {
+	var items []string
+
+	if !m.Date.IsZero() {
+		items = append(items, m.Date.Format(metaDate))
+	}
+
+	if m.ReadingTime > 0 {
+		items = append(items, fmt.Sprintf("%d min read", m.ReadingTime))
+	}
+
+	if m.Category != "" {
+		items = append(items, m.Category)
+	}
+
+	return items
+}
+
+// text returns all the texts of the metadata line and the tags for the glyphs check.
+func (m Meta) text() string {
+	return strings.Join(append(m.items(), m.Tags...), " ")
+}
+
+// subtitleFont returns the subtitle font spec: the author family in the regular weight.
+func (p *Preview) subtitleFont() fontSpec {
+	return newFontSpec(p.opts.AuthorFont, WeightRegular, p.opts.AuthorStyle, p.opts.SubtitleSize)
+}
+
+// metaFont returns the metadata line and the tags font spec: the author family in the regular weight.
+func (p *Preview) metaFont() fontSpec {
+	return newFontSpec(p.opts.AuthorFont, WeightRegular, p.opts.AuthorStyle, p.opts.Meta.Size)
+}
+
+// drawSubtitle draws the subtitle under the title in as many of SubtitleLines as fit above the logo row,
+// the rest is truncated with "…". It's dropped when not a single line fits.
+func (p *Preview) drawSubtitle(ctx context.Context) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawSubtitle")
+
+	defer func() { tracing.End(span, err) }()
+
+	if p.opts.Subtitle == "" || p.opts.SubtitleSize <= 0 {
+		return nil
+	}
+
+	if err := p.setFont(p.subtitleFont()); err != nil {
+		return err
+	}
+
+	top := p.titleBottom + subtitleGap
+	bottom := float64(p.opts.CanvasH-p.opts.LogoH) - padding*1.5
+	step := p.ctx.FontHeight() * titleLineSpacing
+	fit := int((bottom-top-p.ctx.FontHeight())/step) + 1
+	subtitle := plain(p.opts.Subtitle)
+
+	if fit < 1 {
+		p.report.Subtitle = &TextReport{Lines: []string{}, Truncated: true}
+
+		return nil
+	}
+
+	left, right := p.textBox()
+	maxWidth := right - left
+	maxLines := min(fit, max(1, p.opts.SubtitleLines))
+	lines, truncated := p.truncateTo(p.wrap(subtitle, maxWidth, maxLines), maxLines, maxWidth)
+	// aligned like the title
+	x, ax := p.opts.TitleTypography.Align.anchor(left, right, isRTL(subtitle.text))
+
+	p.setColor(p.theme.author)
+	p.drawLines(lines, x, top, ax, titleLineSpacing)
+
+	drawn := join(lines, " ")
+	runs, err := p.richGlyphRuns(drawn)
+
+	if err != nil {
+		return fmt.Errorf("could not split the subtitle to glyph runs: %w", err)
+	}
+
+	p.report.Subtitle = &TextReport{Text: drawn.text, Lines: texts(lines), Truncated: truncated, Runs: runs}
+
+	return nil
+}
+
+// drawMeta draws the metadata line and the tag chips in the logo row between the left padding and the logo.
+// When they don't fit, the tags are dropped from the end, then the metadata items, and the last item left
+// is cut off with "…".
+func (p *Preview) drawMeta(ctx context.Context) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawMeta")
+
+	defer func() { tracing.End(span, err) }()
+
+	items, tags := p.opts.Meta.items(), p.opts.Meta.Tags
+
+	if (len(items) == 0 && len(tags) == 0) || p.opts.Meta.Size <= 0 {
+		return nil
+	}
+
+	if err := p.setFont(p.metaFont()); err != nil {
+		return err
+	}
+
+	size := p.opts.Meta.Size
+	maxWidth := float64(p.logo.Min.X) - padding/2 - padding
+	line := strings.Join(items, metaSeparator)
+	truncated := false
+
+	for p.metaWidth(line, tags) > maxWidth {
+		truncated = true
+
+		switch {
+		case len(tags) > 0:
+			tags = tags[:len(tags)-1]
+		case len(items) > 1:
+			items = items[:len(items)-1]
+			line = strings.Join(items, metaSeparator)
+		default:
+			line = cutOff(line)
+		}
+
+		if line == ellipsis && len(tags) == 0 {
+			line = ""
+
+			break
+		}
+	}
+
+	// vertically centered at the logo like gg.Context.DrawStringAnchored does
+	cy := float64(p.opts.CanvasH) - padding - float64(p.opts.LogoH)/2
+	baseline := cy + p.ctx.FontHeight()/2
+	x := padding
+
+	if line != "" {
+		p.setColor(p.theme.author)
+		p.drawText(line, x, baseline)
+
+		x += p.measure(line) + padding/2
+	}
+
+	chip := toNRGBA(p.theme.title)
+	chip.A = uint8(255 * chipOpacity)
+
+	for _, tag := range tags {
+		w := p.measure(tag) + size*chipPadding*2
+		h := size * chipHeight
+
+		p.ctx.SetColor(chip)
+		p.ctx.DrawRoundedRectangle(x, cy-h/2, w, h, h/2)
+		p.ctx.Fill()
+		p.setColor(p.theme.title)
+		p.drawText(tag, x+size*chipPadding, baseline)
+
+		x += w + size*chipGap
+	}
+
+	p.report.Meta = &TextReport{Text: line, Lines: append([]string{line}, tags...), Truncated: truncated}
+
+	return nil
+}
+
+// metaWidth returns the width of the metadata line followed by the tag chips with the current font face.
+func (p *Preview) metaWidth(line string, tags []string) float64 {
+	size := p.opts.Meta.Size
+	w, gap := 0.0, 0.0
+
+	if line != "" {
+		// the line is followed by a wider gap than the chips have between them
+		w, gap = p.measure(line), padding/2
+	}
+
+	for _, tag := range tags {
+		w += gap + p.measure(tag) + size*chipPadding*2
+		gap = size * chipGap
+	}
+
+	return w
+}
+
+// cutOff cuts the last grapheme cluster off the text ending with "…" and appends it again.
+func cutOff(text string) string {
+	text = strings.TrimSuffix(text, ellipsis)
+
+	if text == "" {
+		return ellipsis
+	}
+
+	clusters := graphemes(text)
+
+	return strings.TrimRightFunc(text[:len(text)-len(clusters[len(clusters)-1])], unicode.IsSpace) + ellipsis
+}
+
+// metaBox returns the box of the logo row the metadata line and the tags are drawn in.
+func (p *Preview) metaBox() image.Rectangle {
+	return image.Rect(int(padding), p.opts.CanvasH-int(padding)-p.opts.LogoH, p.opts.CanvasW-int(padding), p.opts.CanvasH-int(padding))
+}
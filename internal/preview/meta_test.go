@@ -0,0 +1,118 @@
+package preview
+
+import (
+	"context"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+func newMetaPreview(t *testing.T, opts Options) *Preview {
+	t.Helper()
+
+	opts.CanvasW, opts.CanvasH, opts.LogoH = 1200, 630, 48
+	p := &Preview{opts: &opts, ctx: gg.NewContext(1200, 630), theme: darkTheme, report: &Report{}}
+	// the logo is 200px wide at the bottom right corner
+	p.logo = image.Rect(952, 534, 1152, 582)
+
+	return p
+}
+
+func TestDrawMeta(t *testing.T) {
+	meta := Meta{
+		Date:        time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+		ReadingTime: 5,
+		Category:    "Stories",
+		Tags:        []string{"go", "images", "design"},
+		Size:        26,
+	}
+
+	line := "May 1, 2024 · 5 min read · Stories"
+	testCases := []struct {
+		name string
+		// the text the space between the padding and the logo is measured to fit
+		fits     string
+		expected []string
+	}{{
+		name:     "everything fits",
+		expected: []string{line, "go", "images", "design"},
+	}, {
+		name:     "tags dropped",
+		fits:     line,
+		expected: []string{line},
+	}, {
+		name:     "items dropped",
+		fits:     "May 1, 2024 · 5 min read",
+		expected: []string{"May 1, 2024 · 5 min read"},
+	}, {
+		name:     "last item cut off",
+		fits:     "May 1…",
+		expected: []string{"May 1…"},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newMetaPreview(t, Options{Meta: meta})
+
+			if tt.fits != "" {
+				if err := p.setFont(p.metaFont()); err != nil {
+					t.Fatal(err)
+				}
+
+				p.logo.Min.X = int(padding+p.measure(tt.fits)+padding/2) + 1
+			}
+
+			if err := p.drawMeta(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := p.report.Meta.Lines; !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+
+			if w := p.metaWidth(p.report.Meta.Text, p.report.Meta.Lines[1:]); padding+w > float64(p.logo.Min.X)-padding/2 {
+				t.Errorf("expected the metadata to end before the logo at %d, it ends at %.0f", p.logo.Min.X, padding+w)
+			}
+		})
+	}
+}
+
+func TestDrawSubtitle(t *testing.T) {
+	subtitle := strings.Repeat("A short story about a fox and a dog. ", 5)
+	testCases := []struct {
+		name        string
+		titleBottom float64
+		lines       int
+	}{{
+		name:        "max lines",
+		titleBottom: 300,
+		lines:       2,
+	}, {
+		name:        "space left",
+		titleBottom: 450,
+		lines:       1,
+	}, {
+		name:        "dropped",
+		titleBottom: 500,
+		lines:       0,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newMetaPreview(t, Options{Subtitle: subtitle, SubtitleSize: 36, SubtitleLines: 2})
+			p.titleBottom = tt.titleBottom
+
+			if err := p.drawSubtitle(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := p.report.Subtitle; len(actual.Lines) != tt.lines || !actual.Truncated {
+				t.Errorf("expected %d truncated lines, got %q", tt.lines, actual.Lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// OverlayShape is a shape of the foreground overlay under the text elements.
+type OverlayShape string
+
+// Overlay shapes, the zero value is the rectangle inset by the margin
+const (
+	OverlayInset OverlayShape = ""
+	OverlayFull  OverlayShape = "full"
+	OverlayCard  OverlayShape = "card"
+	OverlayPanel OverlayShape = "panel"
+)
+
+// OverlayFill is a fill of the foreground overlay.
+type OverlayFill string
+
+// Overlay fills, the zero value is the solid color of the opacity
+const (
+	OverlaySolid  OverlayFill = ""
+	OverlayLinear OverlayFill = "linear"
+	OverlayRadial OverlayFill = "radial"
+)
+
+// cardRadius is the default corner radius of the card overlay
+const cardRadius = 24.0
+
+// OverlayAngle is the default direction of the linear overlay gradient, opaque at the bottom under the logo row
+const OverlayAngle = 90.0
+
+// Overlay defines the foreground drawn over the background under the text elements. Zero values draw
+// the solid rectangle inset by the margin in the theme color.
+type Overlay struct {
+	Shape OverlayShape `json:"shape"`
+	Fill  OverlayFill  `json:"fill"`
+	// Overlay color in HEX, the opacity is set by Options.Opacity
+	Color string `json:"color"`
+	// Corner radius of the card
+	Radius float64 `json:"radius"`
+	// Direction of the linear gradient in degrees from transparent to opaque: 0 is to the right, 90 is to the bottom,
+	// see OverlayAngle
+	Angle float64 `json:"angle"`
+}
+
+// ParseOverlayShape parses an overlay shape: inset, full, card or panel.
+func ParseOverlayShape(s string) (OverlayShape, error) {
+	switch shape := OverlayShape(strings.ToLower(s)); shape {
+	case OverlayFull, OverlayCard, OverlayPanel:
+		return shape, nil
+	case "inset":
+		return OverlayInset, nil
+	default:
+		return OverlayInset, fmt.Errorf("unknown overlay shape %q", s)
+	}
+}
+
+// ParseOverlayFill parses an overlay fill: solid, linear or radial.
+func ParseOverlayFill(s string) (OverlayFill, error) {
+	switch fill := OverlayFill(strings.ToLower(s)); fill {
+	case OverlayLinear, OverlayRadial:
+		return fill, nil
+	case "solid":
+		return OverlaySolid, nil
+	default:
+		return OverlaySolid, fmt.Errorf("unknown overlay fill %q", s)
+	}
+}
+
+// overlayColor returns the opaque overlay color: the one of the options, the theme one tinted with the dominant color
+// of the background or the theme one.
+func (p *Preview) overlayColor(t theme) color.NRGBA {
+	if c, err := ParseColor(p.opts.Overlay.Color); err == nil {
+		overlay := toNRGBA(c)
+		overlay.A = 255
+
+		return overlay
+	}
+
+	if p.opts.Tint && len(p.swatches) > 0 {
+		c, _ := ParseColor(p.swatches[0].Color)
+
+		return blend(toNRGBA(c), t.overlay, tintMix)
+	}
+
+	return t.overlay
+}
+
+// overlayRect returns the box of the overlay shape.
+func (p *Preview) overlayRect() (x, y, w, h float64) {
+	canvasW, canvasH := float64(p.opts.CanvasW), float64(p.opts.CanvasH)
+
+	switch p.opts.Overlay.Shape {
+	case OverlayFull:
+		return 0, 0, canvasW, canvasH
+	case OverlayPanel:
+		// a full width band from the top edge to the bottom of the text elements, the logo row stays clear
+		bottom := 0
+
+		for _, box := range p.textBoxes(p.theme) {
+			// the metadata line is in the logo row
+			if box.element != "meta" {
+				bottom = max(bottom, box.rect.Max.Y)
+			}
+		}
+
+		return 0, 0, canvasW, math.Min(canvasH, float64(bottom)+padding/2)
+	default:
+		return margin, margin, canvasW - margin*2, canvasH - margin*2
+	}
+}
+
+// drawOverlay fills the overlay shape with the color of the opacity, either solid or fading from transparent.
+func (p *Preview) drawOverlay(c color.NRGBA, opacity float64) {
+	x, y, w, h := p.overlayRect()
+	opaque := c
+	opaque.A = uint8(255.0 * opacity)
+	transparent := c
+	transparent.A = 0
+
+	switch p.opts.Overlay.Fill {
+	case OverlayLinear:
+		x0, y0, x1, y1 := p.gradientLine()
+		gradient := gg.NewLinearGradient(x0, y0, x1, y1)
+
+		gradient.AddColorStop(0, transparent)
+		gradient.AddColorStop(1, opaque)
+		p.ctx.SetFillStyle(gradient)
+	case OverlayRadial:
+		cx, cy := x+w/2, y+h/2
+		gradient := gg.NewRadialGradient(cx, cy, 0, cx, cy, math.Hypot(w/2, h/2))
+
+		gradient.AddColorStop(0, transparent)
+		gradient.AddColorStop(1, opaque)
+		p.ctx.SetFillStyle(gradient)
+	default:
+		p.ctx.SetColor(opaque)
+	}
+
+	if p.opts.Overlay.Shape == OverlayCard {
+		radius := p.opts.Overlay.Radius
+
+		if radius <= 0 {
+			radius = cardRadius
+		}
+
+		p.ctx.DrawRoundedRectangle(x, y, w, h, math.Min(radius, math.Min(w, h)/2))
+	} else {
+		p.ctx.DrawRectangle(x, y, w, h)
+	}
+
+	p.ctx.Fill()
+}
+
+// gradientLine returns the line of the linear gradient from transparent to opaque: it goes through the center
+// of the overlay shape and reaches the farthest corners.
+func (p *Preview) gradientLine() (x0, y0, x1, y1 float64) {
+	x, y, w, h := p.overlayRect()
+	angle := p.opts.Overlay.Angle * math.Pi / 180
+	dx, dy := math.Cos(angle), math.Sin(angle)
+	d := math.Abs(w/2*dx) + math.Abs(h/2*dy)
+	cx, cy := x+w/2, y+h/2
+
+	return cx - d*dx, cy - d*dy, cx + d*dx, cy + d*dy
+}
+
+// overlayCoverage returns the share of the overlay opacity at the most transparent point of the rectangle:
+// 0 when a part of it is outside of the overlay shape, 1 for the solid fill, the gradient offset nearest
+// to the transparent end otherwise.
+func (p *Preview) overlayCoverage(r image.Rectangle) float64 {
+	x, y, w, h := p.overlayRect()
+
+	if !r.In(image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Ceil(x+w)), int(math.Ceil(y+h)))) {
+		return 0
+	}
+
+	switch p.opts.Overlay.Fill {
+	case OverlayLinear:
+		x0, y0, x1, y1 := p.gradientLine()
+		dx, dy := x1-x0, y1-y0
+		coverage := 1.0
+
+		// the offset changes linearly, so it's the lowest at one of the corners
+		for _, pt := range []image.Point{r.Min, {X: r.Max.X, Y: r.Min.Y}, {X: r.Min.X, Y: r.Max.Y}, r.Max} {
+			offset := ((float64(pt.X)-x0)*dx + (float64(pt.Y)-y0)*dy) / (dx*dx + dy*dy)
+			coverage = math.Min(coverage, math.Max(0, offset))
+		}
+
+		return coverage
+	case OverlayRadial:
+		cx, cy := x+w/2, y+h/2
+		// the point of the rectangle nearest to the transparent center
+		nx := math.Max(float64(r.Min.X), math.Min(cx, float64(r.Max.X)))
+		ny := math.Max(float64(r.Min.Y), math.Min(cy, float64(r.Max.Y)))
+
+		return math.Min(1, math.Hypot(nx-cx, ny-cy)/math.Hypot(w/2, h/2))
+	default:
+		return 1
+	}
+}
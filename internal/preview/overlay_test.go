@@ -0,0 +1,129 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestDrawOverlay(t *testing.T) {
+	type pixel struct {
+		x, y int
+		// expected red channel over the white background under the black overlay
+		lo, hi uint8
+	}
+
+	testCases := []struct {
+		name    string
+		overlay Overlay
+		pixels  []pixel
+	}{{
+		name:    "inset",
+		overlay: Overlay{},
+		pixels:  []pixel{{5, 5, 255, 255}, {300, 150, 0, 0}},
+	}, {
+		name:    "full",
+		overlay: Overlay{Shape: OverlayFull},
+		pixels:  []pixel{{0, 0, 0, 0}, {599, 314, 0, 0}},
+	}, {
+		name:    "card",
+		overlay: Overlay{Shape: OverlayCard, Radius: 40},
+		pixels:  []pixel{{int(margin) + 2, int(margin) + 2, 255, 255}, {int(margin) + 40, int(margin) + 2, 0, 0}},
+	}, {
+		name:    "panel",
+		overlay: Overlay{Shape: OverlayPanel},
+		pixels:  []pixel{{0, 0, 0, 0}, {300, 310, 255, 255}},
+	}, {
+		name:    "linear",
+		overlay: Overlay{Shape: OverlayFull, Fill: OverlayLinear, Angle: 90},
+		pixels:  []pixel{{300, 0, 250, 255}, {300, 157, 120, 135}, {300, 314, 0, 5}},
+	}, {
+		name:    "radial",
+		overlay: Overlay{Shape: OverlayFull, Fill: OverlayRadial, Color: "#00FFFF"},
+		pixels:  []pixel{{300, 157, 255, 255}, {0, 0, 0, 5}},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preview{
+				opts:  &Options{CanvasW: 600, CanvasH: 315, LogoH: 24, Overlay: tt.overlay},
+				ctx:   gg.NewContext(600, 315),
+				theme: darkTheme,
+			}
+
+			p.ctx.SetColor(color.White)
+			p.ctx.Clear()
+			p.drawOverlay(p.overlayColor(p.theme), 1)
+
+			for _, px := range tt.pixels {
+				if r := toNRGBA(p.ctx.Image().At(px.x, px.y)).R; r < px.lo || r > px.hi {
+					t.Errorf("expected the red channel at %d,%d from %d to %d, got %d", px.x, px.y, px.lo, px.hi, r)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlayCoverage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		overlay  Overlay
+		rect     image.Rectangle
+		expected float64
+	}{{
+		name:     "solid",
+		overlay:  Overlay{Shape: OverlayFull},
+		rect:     image.Rect(0, 0, 100, 100),
+		expected: 1,
+	}, {
+		name:     "linear to the right",
+		overlay:  Overlay{Shape: OverlayFull, Fill: OverlayLinear},
+		rect:     image.Rect(300, 0, 600, 315),
+		expected: 0.5,
+	}, {
+		name:     "linear to the bottom",
+		overlay:  Overlay{Shape: OverlayFull, Fill: OverlayLinear, Angle: 90},
+		rect:     image.Rect(0, 252, 600, 315),
+		expected: 0.8,
+	}, {
+		name:     "linear to the left",
+		overlay:  Overlay{Shape: OverlayFull, Fill: OverlayLinear, Angle: 180},
+		rect:     image.Rect(300, 0, 600, 315),
+		expected: 0,
+	}, {
+		name:     "radial over the center",
+		overlay:  Overlay{Shape: OverlayFull, Fill: OverlayRadial},
+		rect:     image.Rect(200, 100, 400, 200),
+		expected: 0,
+	}, {
+		name:     "radial in the corner",
+		overlay:  Overlay{Shape: OverlayFull, Fill: OverlayRadial},
+		rect:     image.Rect(0, 0, 150, 78),
+		expected: 0.5,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preview{opts: &Options{CanvasW: 600, CanvasH: 315, Overlay: tt.overlay}}
+
+			if actual := p.overlayCoverage(tt.rect); math.Abs(actual-tt.expected) > 0.01 {
+				t.Errorf("expected the coverage %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOverlayRect_PanelMeta(t *testing.T) {
+	opts := Options{CanvasW: 600, CanvasH: 315, LogoH: 24, Overlay: Overlay{Shape: OverlayPanel}}
+	_, _, _, expected := (&Preview{opts: &opts}).overlayRect()
+
+	opts.Meta = Meta{Category: "Stories", Tags: []string{"go"}, Size: 13}
+	p := &Preview{opts: &opts}
+
+	if _, _, _, h := p.overlayRect(); h != expected || h > float64(p.metaBox().Min.Y) {
+		t.Errorf("expected the panel to end at %v above the logo row, got %v", expected, h)
+	}
+}
@@ -0,0 +1,174 @@
+package preview
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-text/typesetting/font"
+)
+
+// packs lists the fallback fonts found in the fonts directory, it's set once at startup
+var packs []*fontFile
+
+// runeRange is an inclusive range of code points.
+type runeRange struct {
+	lo, hi rune
+}
+
+// ScanFonts indexes the TTF, OTF and TTC fonts in the directory as fallback font packs (e.g. Noto Sans CJK)
+// and registers them as font families by their names, returning the number of fonts found.
+// Only the coverage of the fonts is kept in memory until a text needs one of them. It should be called once at startup.
+func ScanFonts(dir string) (int, error) {
+	paths, err := os.ReadDir(dir)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not read the fonts directory: %w", err)
+	}
+
+	found := []*fontFile{}
+
+	for _, entry := range paths {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+
+		if entry.IsDir() || (ext != ".ttf" && ext != ".otf" && ext != ".ttc" && ext != ".otc") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		faces, err := parseFontFile(path)
+
+		if err != nil {
+			slog.Warn("could not parse a font", "path", path, "err", err)
+			continue
+		}
+
+		for i, face := range faces {
+			desc := face.Describe()
+			style := StyleNormal
+
+			if desc.Aspect.Style == font.StyleItalic {
+				style = StyleItalic
+			}
+
+			ff := &fontFile{
+				name:     fontName(path, i, len(faces)),
+				weight:   Weight(desc.Aspect.Weight),
+				style:    style,
+				read:     readFile(path),
+				index:    i,
+				coverage: coverage(face),
+			}
+
+			registerFont(desc.Family, ff)
+			found = append(found, ff)
+		}
+	}
+
+	packs = found
+
+	return len(found), nil
+}
+
+// fontName returns the font file name without an extension followed by the index for fonts collections.
+func fontName(path string, i, n int) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	if n > 1 {
+		name = fmt.Sprintf("%s#%d", name, i)
+	}
+
+	return name
+}
+
+// readFile returns a reader of the font file for fontFile.
+func readFile(path string) func() ([]byte, error) {
+	return func() ([]byte, error) { return os.ReadFile(path) }
+}
+
+// parseFontFile parses a font file or a fonts collection.
+func parseFontFile(path string) ([]*font.Face, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if ext == ".ttc" || ext == ".otc" {
+		return font.ParseTTC(file)
+	}
+
+	face, err := font.ParseTTF(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []*font.Face{face}, nil
+}
+
+// coverage collects the code points the font has glyphs for to sorted ranges.
+func coverage(face *font.Face) []runeRange {
+	runes := []rune{}
+	iter := face.Cmap.Iter()
+
+	for iter.Next() {
+		r, _ := iter.Char()
+		runes = append(runes, r)
+	}
+
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	ranges := []runeRange{}
+
+	for _, r := range runes {
+		if n := len(ranges); n > 0 && r <= ranges[n-1].hi+1 {
+			ranges[n-1].hi = r
+		} else {
+			ranges = append(ranges, runeRange{lo: r, hi: r})
+		}
+	}
+
+	return ranges
+}
+
+// covers reports whether the font has a glyph for the rune.
+func (ff *fontFile) covers(r rune) bool {
+	i := sort.Search(len(ff.coverage), func(i int) bool { return ff.coverage[i].hi >= r })
+
+	return i < len(ff.coverage) && ff.coverage[i].lo <= r
+}
+
+// packFor returns the first font pack having a glyph for the rune.
+func packFor(r rune) *fontFile {
+	for _, ff := range packs {
+		if ff.covers(r) {
+			return ff
+		}
+	}
+
+	return nil
+}
+
+// needsPack reports whether the letter is missing in the current family font but one of the font packs has it.
+// Symbols are left to the embedded symbol fonts.
+func (p *Preview) needsPack(r rune) bool {
+	if len(packs) == 0 || !isLetter(r) || p.chain.primary.has(r) {
+		return false
+	}
+
+	return packFor(r) != nil
+}
+
+// isLetter reports whether the rune is a letter, a digit or a Chinese or Japanese character.
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || isCJK(r)
+}
@@ -0,0 +1,108 @@
+package preview
+
+import (
+	"reflect"
+	"testing"
+)
+
+func scanTestFonts(t *testing.T) {
+	found, err := ScanFonts("./testdata/fonts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found != 1 {
+		t.Fatalf("expected 1 font pack, got %d", found)
+	}
+
+	t.Cleanup(func() {
+		packs = nil
+
+		registry.Lock()
+		defer registry.Unlock()
+
+		for key, f := range registry.families {
+			if len(f.variants) > 0 && f.variants[0].coverage != nil {
+				delete(registry.families, key)
+			}
+		}
+	})
+}
+
+func TestScanFonts_Missing(t *testing.T) {
+	if _, err := ScanFonts("./testdata/missing"); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestNeedsPack(t *testing.T) {
+	p := newTestPreview(t, 40)
+
+	if p.needsPack('中') {
+		t.Error("expected no font packs before scanning")
+	}
+
+	scanTestFonts(t)
+
+	testCases := []struct {
+		name     string
+		r        rune
+		expected bool
+	}{{
+		name:     "han",
+		r:        '中',
+		expected: true,
+	}, {
+		name:     "kana",
+		r:        'か',
+		expected: true,
+	}, {
+		name:     "latin",
+		r:        'a',
+		expected: false,
+	}, {
+		name:     "symbol",
+		r:        '★',
+		expected: false,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := p.needsPack(tt.r); actual != tt.expected {
+				t.Errorf("%q: expected %v, got %v", tt.r, tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFontPackLazyLoad(t *testing.T) {
+	scanTestFonts(t)
+
+	fp := packs[0]
+	p := newTestPreview(t, 40)
+
+	if fp.ot != nil {
+		t.Fatal("the font pack is expected to be loaded only when needed")
+	}
+
+	if _, err := p.glyphRuns("Hello"); err != nil || fp.ot != nil {
+		t.Fatalf("the font pack is not expected to be loaded for covered text: %v", err)
+	}
+
+	runs, err := p.glyphRuns("Go 語言")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []GlyphRun{{Text: "Go ", Font: "Ubuntu-Medium"}, {Text: "語言", Font: "AdobeBlank2"}}
+
+	if !reflect.DeepEqual(runs, expected) {
+		t.Errorf("expected runs %+v, got %+v", expected, runs)
+	}
+
+	if fp.ot == nil {
+		t.Error("the font pack is expected to be loaded")
+	}
+}
@@ -0,0 +1,224 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BgPalette is a background generated from the dominant colors of the logo.
+type BgPalette string
+
+// Palette backgrounds, the zero value keeps the bg option
+const (
+	BgPaletteNone     BgPalette = ""
+	BgPaletteSolid    BgPalette = "solid"
+	BgPaletteGradient BgPalette = "gradient"
+)
+
+const (
+	// PaletteSize is the default number of the palette colors
+	PaletteSize = 5
+	// paletteThumbnail is the max side of the image thumbnail the palette is extracted from
+	paletteThumbnail = 64
+	// tintMix is the share of the theme overlay color mixed into the dominant color of the tinted overlay
+	tintMix = 0.5
+)
+
+// Swatch is a color of an image palette and the share of the image pixels close to it.
+type Swatch struct {
+	// HEX color, e.g. #E8590C
+	Color string  `json:"color"`
+	Share float64 `json:"share"`
+}
+
+// ParseBgPalette parses a palette background: solid or gradient.
+func ParseBgPalette(s string) (BgPalette, error) {
+	switch bg := BgPalette(strings.ToLower(s)); bg {
+	case BgPaletteSolid, BgPaletteGradient:
+		return bg, nil
+	default:
+		return BgPaletteNone, fmt.Errorf("unknown palette background %q", s)
+	}
+}
+
+// Palette fetches the image from the URL or the local path and returns up to n of its dominant colors,
+// the most common first.
+func (p *Preview) Palette(ctx context.Context, urlOrPath string, n int) ([]Swatch, error) {
+	ctx, span := tracing.Start(ctx, "preview.Palette")
+	swatches, err := func() ([]Swatch, error) {
+		resources, err := p.remote.GetAll(ctx, map[string]string{paletteKey: urlOrPath})
+
+		if err != nil {
+			return nil, fmt.Errorf("could not get an image: %w", err)
+		}
+
+		return palette(ctx, resources[paletteKey].Buf, n)
+	}()
+
+	tracing.End(span, err)
+
+	return swatches, err
+}
+
+// palette returns up to n dominant colors of the image, it's downscaled with vips first.
+// Mostly transparent pixels, e.g. around a logo, are skipped.
+func palette(ctx context.Context, buf []byte, n int) (_ []Swatch, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width > paletteThumbnail || config.Height > paletteThumbnail {
+		if buf, err = thumbnail(ctx, buf, paletteThumbnail); err != nil {
+			return nil, fmt.Errorf("could not downscale the image: %w", err)
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the image: %w", err)
+	}
+
+	pixels := make([][3]uint8, 0, img.Bounds().Dx()*img.Bounds().Dy())
+
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if c := toNRGBA(img.At(x, y)); c.A >= 128 {
+				pixels = append(pixels, [3]uint8{c.R, c.G, c.B})
+			}
+		}
+	}
+
+	return medianCut(pixels, n), nil
+}
+
+// thumbnail downscales the image to fit the square of the side keeping its aspect ratio.
+func thumbnail(ctx context.Context, buf []byte, side int) (_ []byte, err error) {
+	startedAt := time.Now()
+	ctx, span := tracing.Start(ctx, "vips.Thumbnail", attribute.Int("to_side", side))
+
+	defer func() { tracing.End(span, err) }()
+
+	vipsImg, err := vips.NewImageFromBuffer(buf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer vipsImg.Close()
+
+	if err = vipsImg.Thumbnail(side, side, vips.InterestingNone); err != nil {
+		return nil, err
+	}
+
+	buf, _, err = vipsImg.Export(vips.NewDefaultExportParams())
+
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "made a thumbnail", "side", side, "took", time.Since(startedAt))
+
+	return buf, nil
+}
+
+// medianCut splits the pixels into up to n boxes of similar colors: each time the box with the widest
+// channel range is split in two at the median of that channel. It returns the average colors of the boxes.
+func medianCut(pixels [][3]uint8, n int) []Swatch {
+	if len(pixels) == 0 || n < 1 {
+		return nil
+	}
+
+	boxes := [][][3]uint8{pixels}
+
+	for len(boxes) < n {
+		widest, channel, widestRange := -1, 0, 0
+
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+
+			if ch, r := widestChannel(box); r > widestRange {
+				widest, channel, widestRange = i, ch, r
+			}
+		}
+
+		// all the boxes are of a single color
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+
+		sort.Slice(box, func(i, j int) bool { return box[i][channel] < box[j][channel] })
+
+		median := len(box) / 2
+		boxes[widest] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+
+	swatches := make([]Swatch, 0, len(boxes))
+
+	for _, box := range boxes {
+		var sum [3]int
+
+		for _, px := range box {
+			for ch := range sum {
+				sum[ch] += int(px[ch])
+			}
+		}
+
+		c := color.NRGBA{
+			R: uint8(sum[0] / len(box)),
+			G: uint8(sum[1] / len(box)),
+			B: uint8(sum[2] / len(box)),
+			A: 255,
+		}
+
+		swatches = append(swatches, Swatch{Color: hexColor(c), Share: float64(len(box)) / float64(len(pixels))})
+	}
+
+	sort.SliceStable(swatches, func(i, j int) bool { return swatches[i].Share > swatches[j].Share })
+
+	return swatches
+}
+
+// widestChannel returns the channel of the pixels with the widest range of values and the range.
+func widestChannel(pixels [][3]uint8) (int, int) {
+	lo, hi := pixels[0], pixels[0]
+
+	for _, px := range pixels {
+		for ch := range px {
+			lo[ch], hi[ch] = min(lo[ch], px[ch]), max(hi[ch], px[ch])
+		}
+	}
+
+	channel, r := 0, 0
+
+	for ch := range lo {
+		if d := int(hi[ch]) - int(lo[ch]); d > r {
+			channel, r = ch, d
+		}
+	}
+
+	return channel, r
+}
+
+// hexColor formats the color as #RRGGBB.
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
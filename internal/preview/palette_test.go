@@ -0,0 +1,26 @@
+package preview
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMedianCut(t *testing.T) {
+	red, blue := [3]uint8{255, 0, 0}, [3]uint8{0, 0, 255}
+	pixels := [][3]uint8{red, blue, red, red, {250, 0, 0}, red, blue, red}
+	// the reds split off the blues first, then the slightly darker one splits off
+	expected := []Swatch{{"#FF0000", 0.5}, {"#0000FF", 0.25}, {"#FC0000", 0.25}}
+
+	if actual := medianCut(pixels, 3); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	// a single color isn't split
+	if actual := medianCut([][3]uint8{red, red, red}, 5); !reflect.DeepEqual(actual, []Swatch{{"#FF0000", 1}}) {
+		t.Errorf("expected a single swatch, got %+v", actual)
+	}
+
+	if actual := medianCut(nil, 5); actual != nil {
+		t.Errorf("expected no swatches for no pixels, got %+v", actual)
+	}
+}
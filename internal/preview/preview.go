@@ -3,70 +3,154 @@ package preview
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"log"
+	"log/slog"
 	"math"
 	"regexp"
-	"unicode/utf8"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/davidbyttow/govips/v2/vips"
 	"github.com/fogleman/gg"
+	"github.com/nDmitry/ogimgd/internal/logging"
 	"github.com/nDmitry/ogimgd/internal/remote"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/font"
 )
 
 const (
 	margin            = 20.0
 	padding           = 48.0
 	border            = 8
-	maxTitleLength    = 90
+	titleLineSpacing  = 1.2
+	ellipsis          = "…"
 	defaultBgColor    = "#FFFFFF"
 	avatarBorderColor = "#FFFFFF"
 	logoKey           = "logo"
 	avaKey            = "avatar"
 	bgKey             = "bg"
+	paletteKey        = "palette"
+)
+
+// Probe components and settings
+const (
+	probeFonts    = "fonts"
+	probeAssets   = "assets"
+	probeVips     = "vips"
+	probeRender   = "render"
+	probeLogo     = "logo.png"
+	probeAva      = "avatar.png"
+	probeCanvasW  = 240
+	probeCanvasH  = 126
+	probeAvaD     = 16
+	probeLogoH    = 12
+	probeFontSize = 12
 )
 
 var hexRe = regexp.MustCompile("^#(?:[0-9a-fA-F]{3}){1,2}$")
 
+// Default text colors
+var (
+	titleColor  color.Color = color.White
+	authorColor color.Color = color.RGBA{R: 255, G: 255, B: 255, A: 204}
+)
+var errProbeSkipped = errors.New("skipped due to a failed dependency")
+
 type getter interface {
-	GetAll(context.Context, map[string]string) (map[string][]byte, error)
+	GetAll(context.Context, map[string]string) (map[string]remote.Resource, error)
 }
 
 // Options defines a set of options required to draw a p.ctx.
 type Options struct {
 	// Canvas width
-	CanvasW int
+	CanvasW int `json:"canvasW"`
 	// Canvas height
-	CanvasH int
+	CanvasH int `json:"canvasH"`
 	// Opacity value for the black foreground under the title
-	Opacity float64
+	Opacity float64 `json:"opacity"`
+	// Shape, fill and color of the foreground
+	Overlay Overlay `json:"overlay"`
+	// Tint the foreground with the dominant color of the background image, or of the logo when there's no one
+	Tint bool `json:"tint"`
+	// Target WCAG contrast ratio of the texts with the background, when it's set the theme and the opacity
+	// of the foreground are picked by the background luminance under the texts instead of Opacity
+	Contrast float64 `json:"contrast"`
 	// Avatar diameter
-	AvaD  int
-	Title string
+	AvaD  int    `json:"avaD"`
+	Title string `json:"title"`
 	// Title font size
-	TitleSize float64
-	Author    string
+	TitleSize float64 `json:"titleSize"`
+	// Pick the largest title font size between TitleMin and TitleMax
+	// at which the wrapped title fits its box instead of using TitleSize
+	TitleFit bool    `json:"titleFit"`
+	TitleMin float64 `json:"titleMin"`
+	TitleMax float64 `json:"titleMax"`
+	// Title font family, weight and style, the closest variant of the family is used
+	TitleFont   string `json:"titleFont"`
+	TitleWeight Weight `json:"titleWeight"`
+	TitleStyle  Style  `json:"titleStyle"`
+	// Title color, alignment, line height, letter spacing, case and effects
+	TitleTypography Typography `json:"titleTypography"`
+	// Break the title to lines of about the same width instead of filling each line up, it's opt-in,
+	// so titles are filled line by line and may end with a single word by default
+	TitleBalance bool `json:"titleBalance"`
+	// Language of the texts as a BCP 47 tag, it selects the title hyphenation patterns and the case mapping rules
+	Lang string `json:"lang"`
+	// Max number of title lines, the rest of the title will be trimmed and replaced with …
+	MaxLines int `json:"maxLines"`
+	// Subtitle drawn under the title, it's truncated to the space the title leaves or dropped
+	Subtitle string `json:"subtitle"`
+	// Subtitle font size
+	SubtitleSize float64 `json:"subtitleSize"`
+	// Max number of subtitle lines
+	SubtitleLines int `json:"subtitleLines"`
+	// Metadata line and tags drawn in the logo row
+	Meta   Meta   `json:"meta"`
+	Author string `json:"author"`
 	// Author font size
-	AuthorSize float64
+	AuthorSize float64 `json:"authorSize"`
+	// Author font family, weight and style
+	AuthorFont   string `json:"authorFont"`
+	AuthorWeight Weight `json:"authorWeight"`
+	AuthorStyle  Style  `json:"authorStyle"`
+	// Author color, alignment, letter spacing, case and effects
+	AuthorTypography Typography `json:"authorTypography"`
+	// Authors of a co-authored post, when set they replace Author, AvaURL and AvaGenerator
+	Authors []Author `json:"authors"`
 	// Logo left part text (optional)
-	LabelL string
+	LabelL string `json:"labelL"`
 	// Logo right part text (optional)
-	LabelR string
+	LabelR string `json:"labelR"`
 	// Label font size
-	LabelSize float64
+	LabelSize float64 `json:"labelSize"`
 	// Either an URL to a remote background image, or filename of the local image, or a HEX-color
 	// An image will be thumbnailed and smart-cropped if it's not of the canvas size
-	Bg string
+	Bg string `json:"bg"`
+	// Fit mode, focal point and filters of the background image
+	Background Background `json:"background"`
+	// Fill the background with the dominant colors of the logo instead of the Bg color
+	BgPalette BgPalette `json:"bgPalette"`
 	// An URL to an author avatar pic
-	AvaURL string
+	AvaURL string `json:"avaURL"`
+	// Crop the avatar to the faces found in it instead of its area of interest
+	AvaFaces bool `json:"avaFaces"`
+	// Shape, border and shadow of the avatar
+	Avatar Avatar `json:"avatar"`
+	// Generate the avatar from the author name instead of fetching AvaURL
+	AvaGenerator AvaGenerator `json:"avaGenerator"`
 	// An URL to a logo image
-	LogoURL string
+	LogoURL string `json:"logoURL"`
 	// Logo height
-	LogoH int
+	LogoH int `json:"logoH"`
 	// Resulting JPEG quality
-	Quality int
+	Quality int `json:"quality"`
+	// Fail with MissingGlyphsError instead of drawing blank boxes for characters missing in the fonts
+	StrictGlyphs bool `json:"strictGlyphs"`
 }
 
 // Preview can draw a preview using the provided Options.
@@ -74,6 +158,30 @@ type Preview struct {
 	opts   *Options
 	ctx    *gg.Context
 	remote getter
+	report *Report
+	// overlay and default text colors
+	theme theme
+	// dominant colors of the background image or the logo when the tint or the palette background needs them
+	swatches []Swatch
+	// bottom of the title lines the subtitle is drawn under and the box of the logo the metadata line ends before
+	titleBottom float64
+	logo        image.Rectangle
+	// current font face, its fallback chain, spec, size and text color
+	face     font.Face
+	chain    *fontChain
+	spec     fontSpec
+	fontSize float64
+	color    color.Color
+	// stroke width added to the glyphs of fonts emboldened synthetically
+	bold float64
+	// letter spacing of the current text relative to the font size
+	tracking float64
+	// shaped text widths for each font
+	widths map[widthKey]float64
+	// emoji images scaled to the font sizes
+	emojis map[emojiKey]image.Image
+	// font faces taken from the pools for this render
+	fonts map[fontSpec]font.Face
 }
 
 // New returns an initialized Preview.
@@ -85,16 +193,87 @@ func New() *Preview {
 	}
 }
 
-// Draw draws a preview using the provided Options.
-func (p *Preview) Draw(ctx context.Context, opts Options) (image.Image, error) {
-	p.opts = &opts
-	p.ctx = gg.NewContext(opts.CanvasW, opts.CanvasH)
+// Draw draws a preview using the provided Options and reports how it was drawn.
+// Each call draws on its own copy of the Preview, so it's safe to call Draw concurrently.
+func (p *Preview) Draw(ctx context.Context, opts Options) (image.Image, *Report, error) {
+	d := &Preview{
+		opts:   &opts,
+		ctx:    gg.NewContext(opts.CanvasW, opts.CanvasH),
+		remote: p.remote,
+		theme:  darkTheme,
+		report: &Report{Options: opts, Assets: make(map[string]*AssetReport)},
+	}
+
+	ctx, span := tracing.Start(ctx, "preview.Draw")
+	img, err := d.draw(ctx)
+
+	d.releaseFonts()
+
+	tracing.End(span, err)
+
+	return img, d.report, err
+}
+
+// Probe draws a tiny preview using the embedded assets only and reports the status of each
+// component of the pipeline: fonts, assets, vips and the whole render. A nil error means the component is ok.
+func (p *Preview) Probe(ctx context.Context) map[string]error {
+	status := map[string]error{
+		probeFonts:  checkFonts(),
+		probeAssets: nil,
+		probeVips:   errProbeSkipped,
+		probeRender: errProbeSkipped,
+	}
+
+	resources, err := p.remote.GetAll(ctx, map[string]string{logoKey: probeLogo, avaKey: probeAva})
+
+	if err != nil {
+		status[probeAssets] = err
+
+		return status
+	}
+
+	// the sizes differ from the embedded images ones, so vips has to do the actual work
+	if _, err = resize(ctx, resources[avaKey].Buf, probeAvaD, probeAvaD); err == nil {
+		_, err = scale(ctx, resources[logoKey].Buf, probeLogoH)
+	}
+
+	status[probeVips] = err
+
+	if status[probeFonts] != nil || status[probeVips] != nil {
+		return status
+	}
+
+	_, _, status[probeRender] = p.Draw(ctx, Options{
+		CanvasW:    probeCanvasW,
+		CanvasH:    probeCanvasH,
+		Opacity:    0.6,
+		AvaD:       probeAvaD,
+		Title:      "Ready",
+		TitleSize:  probeFontSize,
+		Author:     "@ogimgd",
+		AuthorSize: probeFontSize,
+		AvaURL:     probeAva,
+		LogoURL:    probeLogo,
+		LogoH:      probeLogoH,
+	})
+
+	return status
+}
+
+func (p *Preview) draw(ctx context.Context) (image.Image, error) {
+	startedAt := time.Now()
 	bgColor := defaultBgColor
 	isBgHEX := hexRe.Match([]byte(p.opts.Bg))
 	urlsOrPaths := map[string]string{logoKey: p.opts.LogoURL}
 
-	if opts.AvaURL != "" {
-		urlsOrPaths[avaKey] = p.opts.AvaURL
+	for i, a := range p.stacked() {
+		if a.AvaURL != "" {
+			urlsOrPaths[avatarKey(i)] = a.AvaURL
+		}
+	}
+
+	if err := p.checkGlyphs(ctx); err != nil {
+		return nil, err
 	}
 
 	if isBgHEX {
@@ -103,180 +282,543 @@ func (p *Preview) Draw(ctx context.Context, opts Options) (image.Image, error) {
 		urlsOrPaths[bgKey] = p.opts.Bg
 	}
 
-	imgBufs, err := p.remote.GetAll(ctx, urlsOrPaths)
+	resources, err := p.remote.GetAll(ctx, urlsOrPaths)
 
 	if err != nil {
 		return nil, fmt.Errorf("could not get an image: %w", err)
 	}
 
+	imgBufs := make(map[string][]byte, len(resources))
+
+	for key, res := range resources {
+		imgBufs[key] = res.Buf
+		asset := &AssetReport{URL: urlsOrPaths[key], Bytes: len(res.Buf)}
+
+		if config, _, err := image.DecodeConfig(bytes.NewReader(res.Buf)); err == nil {
+			asset.Width, asset.Height = config.Width, config.Height
+		}
+
+		p.report.Assets[key] = asset
+		p.report.Timings = append(p.report.Timings, Timing{Name: "fetch", Desc: key, Took: res.Took})
+	}
+
+	if p.opts.Tint || (p.opts.BgPalette != BgPaletteNone && imgBufs[bgKey] == nil) {
+		if err := p.extractPalette(ctx, imgBufs); err != nil {
+			return nil, err
+		}
+	}
+
+	drawStartedAt := time.Now()
+
 	if isBgHEX || p.opts.Bg == "" {
-		if err := p.drawBackground(nil, bgColor); err != nil {
+		if err := p.drawBackground(ctx, nil, bgColor); err != nil {
 			return nil, err
 		}
 	} else {
-		if err := p.drawBackground(imgBufs[bgKey], bgColor); err != nil {
+		if err := p.drawBackground(logging.With(ctx, "asset", bgKey), imgBufs[bgKey], bgColor); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := p.drawForeground(); err != nil {
+	if err := p.drawForeground(ctx); err != nil {
 		return nil, err
 	}
 
-	if _, exists := imgBufs[avaKey]; exists {
-		if err := p.drawAvatar(imgBufs[avaKey]); err != nil {
-			return nil, err
-		}
+	if err := p.drawAvatars(ctx, imgBufs); err != nil {
+		return nil, err
+	}
+
+	if err := p.drawAuthor(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.drawTitle(ctx); err != nil {
+		return nil, err
 	}
 
-	if err := p.drawAuthor(); err != nil {
+	if err := p.drawSubtitle(ctx); err != nil {
 		return nil, err
 	}
 
-	if err := p.drawTitle(); err != nil {
+	if err := p.drawLogo(logging.With(ctx, "asset", logoKey), imgBufs[logoKey]); err != nil {
 		return nil, err
 	}
 
-	if err := p.drawLogo(imgBufs[logoKey]); err != nil {
+	if err := p.drawMeta(ctx); err != nil {
 		return nil, err
 	}
 
+	p.report.timing("draw", "", drawStartedAt)
+	slog.InfoContext(ctx, "drew a preview", "took", time.Since(startedAt))
+
 	return p.ctx.Image(), nil
 }
 
-func (p *Preview) drawBackground(bgBuf []byte, bgColor string) error {
+func (p *Preview) drawBackground(ctx context.Context, bgBuf []byte, bgColor string) (err error) {
+	ctx, span := tracing.Start(ctx, "preview.drawBackground")
+
+	defer func() { tracing.End(span, err) }()
+
 	if bgBuf == nil {
-		p.ctx.SetHexColor(bgColor)
+		switch {
+		case p.opts.BgPalette == BgPaletteGradient && len(p.swatches) > 1:
+			// from the most common color at the top left corner to the next one at the bottom right
+			from, _ := ParseColor(p.swatches[0].Color)
+			to, _ := ParseColor(p.swatches[1].Color)
+			gradient := gg.NewLinearGradient(0, 0, float64(p.opts.CanvasW), float64(p.opts.CanvasH))
+
+			gradient.AddColorStop(0, from)
+			gradient.AddColorStop(1, to)
+			p.ctx.SetFillStyle(gradient)
+		case p.opts.BgPalette != BgPaletteNone && len(p.swatches) > 0:
+			p.ctx.SetHexColor(p.swatches[0].Color)
+		default:
+			p.ctx.SetHexColor(bgColor)
+		}
+
 		p.ctx.DrawRectangle(0, 0, float64(p.opts.CanvasW), float64(p.opts.CanvasH))
 		p.ctx.Fill()
 
 		return nil
 	}
 
-	bgBuf, err := resize(bgBuf, p.opts.CanvasW, p.opts.CanvasH)
+	startedAt := time.Now()
+	bg := p.opts.Background
+
+	if bg.Faces && bg.Fit == FitCover && bg.Focus == nil {
+		if bg.Focus, err = p.focusOnFaces(ctx, bgKey, bgBuf, p.opts.CanvasW, p.opts.CanvasH); err != nil {
+			return err
+		}
+	}
+
+	if bg.isZero() {
+		bgBuf, err = resize(ctx, bgBuf, p.opts.CanvasW, p.opts.CanvasH)
+	} else {
+		bgBuf, err = fitImage(ctx, bgBuf, p.opts.CanvasW, p.opts.CanvasH, bg)
+	}
 
 	if err != nil {
 		return fmt.Errorf("could not resize the background: %w", err)
 	}
 
+	p.report.timing("resize", bgKey, startedAt)
+
 	bgImg, _, err := image.Decode(bytes.NewReader(bgBuf))
 
 	if err != nil {
 		return fmt.Errorf("could not decode the background: %w", err)
 	}
 
+	p.report.resized(bgKey, bgImg.Bounds())
+
 	p.ctx.DrawImage(bgImg, 0, 0)
 
 	return nil
 }
 
-func (p *Preview) drawForeground() error {
-	p.ctx.SetColor(color.RGBA{0, 0, 0, uint8(255.0 * p.opts.Opacity)})
-	p.ctx.DrawRectangle(margin, margin, float64(p.opts.CanvasW)-(margin*2), float64(p.opts.CanvasH)-(margin*2))
-	p.ctx.Fill()
+// extractPalette extracts the dominant colors of the background image, or of the logo when there's no one.
+func (p *Preview) extractPalette(ctx context.Context, imgBufs map[string][]byte) (err error) {
+	ctx, span := tracing.Start(ctx, "preview.extractPalette")
+
+	defer func() { tracing.End(span, err) }()
+
+	key := bgKey
+
+	if _, exists := imgBufs[bgKey]; !exists {
+		key = logoKey
+	}
+
+	startedAt := time.Now()
+
+	if p.swatches, err = palette(logging.With(ctx, "asset", key), imgBufs[key], PaletteSize); err != nil {
+		return fmt.Errorf("could not extract the palette of the %s: %w", key, err)
+	}
+
+	p.report.timing("palette", key, startedAt)
+	p.report.Palette = p.swatches
+
+	return nil
+}
+
+func (p *Preview) drawForeground(ctx context.Context) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawForeground")
+
+	defer func() { tracing.End(span, err) }()
+
+	opacity := p.opts.Opacity
+
+	if p.opts.Contrast > 0 {
+		p.theme, opacity, p.report.Contrast = p.autoContrast()
+		p.report.Options.Opacity = opacity
+
+		span.SetAttributes(attribute.String("theme", p.theme.name), attribute.Float64("opacity", opacity))
+	}
+
+	p.drawOverlay(p.overlayColor(p.theme), opacity)
+
+	return nil
+}
+
+// drawAvatars draws the avatar stack from the last avatar to the first one, so that each overlaps the next.
+func (p *Preview) drawAvatars(ctx context.Context, imgBufs map[string][]byte) error {
+	stacked := p.stacked()
+
+	for i := len(stacked) - 1; i >= 0; i-- {
+		key := avatarKey(i)
+
+		if buf, exists := imgBufs[key]; exists {
+			if err := p.drawAvatar(logging.With(ctx, "asset", key), key, buf, i); err != nil {
+				return err
+			}
+		} else if stacked[i].AvaGenerator != AvaFetched {
+			if err := p.drawGeneratedAvatar(ctx, stacked[i], i); err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
 
-func (p *Preview) drawAvatar(avaBuf []byte) error {
-	// draw the avatar border circle
-	avaX := padding + float64(p.opts.AvaD+border)/2
-	avaY := padding + float64(p.opts.AvaD+border)/2
+func (p *Preview) drawAvatar(ctx context.Context, key string, avaBuf []byte, i int) (err error) {
+	ctx, span := tracing.Start(ctx, "preview.drawAvatar")
 
-	p.ctx.DrawCircle(avaX, avaY, float64((p.opts.AvaD+8)/2))
-	p.ctx.SetHexColor(avatarBorderColor)
-	p.ctx.Fill()
+	defer func() { tracing.End(span, err) }()
 
-	// draw the avatar itself (cropped to a circle)
-	avaBuf, err := resize(avaBuf, p.opts.AvaD, p.opts.AvaD)
+	startedAt := time.Now()
+	var focus *Focus
+
+	if p.opts.AvaFaces {
+		if focus, err = p.focusOnFaces(ctx, key, avaBuf, p.opts.AvaD, p.opts.AvaD); err != nil {
+			return err
+		}
+	}
+
+	if focus != nil {
+		avaBuf, err = fitImage(ctx, avaBuf, p.opts.AvaD, p.opts.AvaD, Background{Focus: focus})
+	} else {
+		avaBuf, err = resize(ctx, avaBuf, p.opts.AvaD, p.opts.AvaD)
+	}
 
 	if err != nil {
 		return fmt.Errorf("could not resize the avatar: %w", err)
 	}
 
+	p.report.timing("resize", key, startedAt)
+
 	avaImg, _, err := image.Decode(bytes.NewReader(avaBuf))
 
 	if err != nil {
 		return fmt.Errorf("could not decode the avatar: %w", err)
 	}
 
-	avaImg = circle(avaImg)
+	p.report.resized(key, avaImg.Bounds())
+
+	avaX, avaY := p.avatarCenter(i)
 
-	p.ctx.DrawImageAnchored(avaImg, int(avaX), int(avaY), 0.5, 0.5)
+	p.drawAvatarImage(avaImg, avaX, avaY)
 
 	return nil
 }
 
-func (p *Preview) drawAuthor() error {
-	if p.opts.Author == "" {
+func (p *Preview) drawAuthor(ctx context.Context) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawAuthor")
+
+	defer func() { tracing.End(span, err) }()
+
+	if len(p.authors()) == 0 {
 		return nil
 	}
 
-	font, err := loadFont(p.opts.AuthorSize)
-
-	if err != nil {
-		return fmt.Errorf("could not load a font face: %w", err)
+	if err := p.setFont(p.authorFont()); err != nil {
+		return err
 	}
 
-	p.ctx.SetFontFace(font)
-	p.ctx.SetColor(color.RGBA{R: 255, G: 255, B: 255, A: 204})
+	typo := p.opts.AuthorTypography
 
-	authorX := padding + float64(p.opts.AvaD) + padding/2
+	p.setTypography(typo)
+
+	defer p.setTypography(Typography{})
+
+	p.setColor(typo.textColor(p.theme.author))
+
+	left, right := p.authorX(), float64(p.opts.CanvasW)-padding
+	author := p.fitByline(right - left)
+	authorX, authorAX := typo.Align.anchor(left, right, false)
 	authorY := padding + float64(p.opts.AvaD)/2
 
-	p.ctx.DrawStringAnchored(p.opts.Author, authorX, authorY, 0, 0.5)
+	// vertically centered like gg.Context.DrawStringAnchored does
+	p.drawEffects(typo, func() {
+		p.drawText(author, authorX-authorAX*p.measure(author), authorY+p.ctx.FontHeight()/2)
+	})
+
+	runs, err := p.glyphRuns(author)
+
+	if err != nil {
+		return fmt.Errorf("could not split the author to glyph runs: %w", err)
+	}
+
+	p.report.Author = &TextReport{Text: author, Lines: []string{author}, Runs: runs}
 
 	return nil
 }
 
-func (p *Preview) drawTitle() error {
-	font, err := loadFont(p.opts.TitleSize)
+func (p *Preview) drawTitle(ctx context.Context) (err error) {
+	_, span := tracing.Start(ctx, "preview.drawTitle")
+
+	defer func() { tracing.End(span, err) }()
+
+	titleY := padding*2 + float64(p.opts.AvaD)
+	left, right := p.textBox()
+	maxWidth := right - left
+	// the title must not reach the logo row
+	maxHeight := float64(p.opts.CanvasH-p.opts.LogoH) - padding*1.5 - titleY
+	size := p.opts.TitleSize
+	typo := p.opts.TitleTypography
+	title := typo.transform(parseMarkup(p.opts.Title), p.opts.Lang)
+
+	p.setTypography(typo)
+
+	defer p.setTypography(Typography{})
+
+	if p.opts.TitleFit {
+		if size, err = p.fitTitleSize(title, maxWidth, maxHeight); err != nil {
+			return fmt.Errorf("could not fit the title size: %w", err)
+		}
+
+		span.SetAttributes(attribute.Float64("size", size))
+	}
+
+	if err := p.setFont(p.titleFont(size)); err != nil {
+		return err
+	}
+
+	p.setColor(typo.textColor(p.theme.title))
+
+	var wrapped []richText
+
+	if p.opts.TitleBalance {
+		wrapped = p.balance(title, maxWidth)
+	} else {
+		wrapped = p.wrap(title, maxWidth, p.opts.MaxLines)
+	}
+
+	lines, truncated := p.truncate(wrapped, maxWidth)
+	// right-to-left titles are aligned to the right edge by default
+	titleX, titleAX := typo.Align.anchor(left, right, isRTL(title.text))
+
+	p.drawEffects(typo, func() { p.drawLines(lines, titleX, titleY, titleAX, p.titleLineHeight()) })
+
+	p.titleBottom = titleY + p.ctx.FontHeight()*(1+float64(len(lines)-1)*p.titleLineHeight())
+
+	drawn := join(lines, " ")
+	runs, err := p.richGlyphRuns(drawn)
 
 	if err != nil {
-		return fmt.Errorf("could not load a font face: %w", err)
+		return fmt.Errorf("could not split the title to glyph runs: %w", err)
 	}
 
-	p.ctx.SetFontFace(font)
-	p.ctx.SetColor(color.White)
+	p.report.Options.TitleSize = size
+	p.report.Title = &TextReport{
+		Text:      drawn.text,
+		Lines:     texts(lines),
+		Truncated: truncated,
+		Runs:      runs,
+		Spans:     drawn.styledSpans(),
+	}
 
-	titleX := padding
-	titleY := padding*2 + float64(p.opts.AvaD)
-	maxWidth := float64(p.opts.CanvasW) - padding - margin*2
-	title := p.opts.Title
+	return nil
+}
 
-	if utf8.RuneCountInString(title) > maxTitleLength {
-		title = string([]rune(title)[0:maxTitleLength]) + "…"
+// textBox returns the left and the right edges of the box the title and the subtitle are wrapped and aligned in.
+func (p *Preview) textBox() (float64, float64) {
+	return padding, float64(p.opts.CanvasW) - margin*2
+}
+
+// titleFont returns the title font spec of the given size.
+func (p *Preview) titleFont(size float64) fontSpec {
+	return newFontSpec(p.opts.TitleFont, p.opts.TitleWeight, p.opts.TitleStyle, size)
+}
+
+// titleLineHeight returns the title line height relative to the font height.
+func (p *Preview) titleLineHeight() float64 {
+	if p.opts.TitleTypography.LineHeight > 0 {
+		return p.opts.TitleTypography.LineHeight
 	}
 
-	p.ctx.DrawStringWrapped(title, titleX, titleY, 0, 0, maxWidth, 1.2, gg.AlignLeft)
+	return titleLineSpacing
+}
+
+// authorFont returns the author font spec.
+func (p *Preview) authorFont() fontSpec {
+	return newFontSpec(p.opts.AuthorFont, p.opts.AuthorWeight, p.opts.AuthorStyle, p.opts.AuthorSize)
+}
+
+// checkGlyphs reports the characters of the title and the author missing in their fonts before drawing.
+// In the strict glyphs mode it fails with MissingGlyphsError.
+func (p *Preview) checkGlyphs(ctx context.Context) error {
+	elements := []struct {
+		name string
+		text richText
+		spec fontSpec
+	}{
+		{"title", p.opts.TitleTypography.transform(parseMarkup(p.opts.Title), p.opts.Lang), p.titleFont(p.opts.TitleSize)},
+		{"author", p.opts.AuthorTypography.transform(plain(p.authorNames()), p.opts.Lang), p.authorFont()},
+		{"subtitle", plain(p.opts.Subtitle), p.subtitleFont()},
+		{"meta", plain(p.opts.Meta.text()), p.metaFont()},
+	}
+
+	for _, el := range elements {
+		if el.text.text == "" {
+			continue
+		}
+
+		if err := p.setFont(el.spec); err != nil {
+			return err
+		}
+
+		for _, s := range el.text.spans() {
+			var missing []rune
+
+			p.withMark(s.mark, func() { missing = p.missingGlyphs(s.text) })
+
+			for _, r := range missing {
+				p.report.MissingGlyphs = append(p.report.MissingGlyphs, MissingGlyph{
+					Element:   el.name,
+					Char:      string(r),
+					Codepoint: fmt.Sprintf("U+%04X", r),
+				})
+			}
+		}
+	}
+
+	if len(p.report.MissingGlyphs) == 0 {
+		return nil
+	}
+
+	slog.WarnContext(ctx, "some characters have no glyphs", "glyphs", len(p.report.MissingGlyphs))
+
+	if p.opts.StrictGlyphs {
+		return &MissingGlyphsError{Glyphs: p.report.MissingGlyphs}
+	}
 
 	return nil
 }
 
-func (p *Preview) drawLogo(logoBuf []byte) error {
-	logoBuf, err := scale(logoBuf, p.opts.LogoH)
+// truncate keeps the first MaxLines of the wrapped lines. When some lines are cut off, it appends "…"
+// to the last visible line at a word boundary, so that the line still fits the width with the current font face.
+func (p *Preview) truncate(lines []richText, width float64) ([]richText, bool) {
+	return p.truncateTo(lines, p.opts.MaxLines, width)
+}
+
+// truncateTo keeps the first maxLines of the wrapped lines like truncate does.
+func (p *Preview) truncateTo(lines []richText, maxLines int, width float64) ([]richText, bool) {
+	if maxLines <= 0 || len(lines) <= maxLines {
+		return lines, false
+	}
+
+	lines = lines[:maxLines]
+	last := lines[len(lines)-1]
+
+	for {
+		last = last.trimRightFunc(func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsPunct(r)
+		})
+
+		if p.measureRich(last.append(ellipsis, last.lastMark())) <= width || last.text == "" {
+			break
+		}
+
+		// cut the last word off, or the last grapheme cluster of a single word that's too long
+		if i := strings.LastIndexFunc(last.text, unicode.IsSpace); i > 0 {
+			last = last.slice(0, i)
+		} else {
+			clusters := graphemes(last.text)
+			last = last.slice(0, len(last.text)-len(clusters[len(clusters)-1]))
+		}
+	}
+
+	lines[len(lines)-1] = last.append(ellipsis, last.lastMark())
+
+	return lines, true
+}
+
+// fitTitleSize finds the largest integer font size between TitleMin and TitleMax at which the wrapped title
+// fits the box of the given width and height in MaxLines. It falls back to TitleMin when the title doesn't fit at any size.
+func (p *Preview) fitTitleSize(title richText, width, height float64) (float64, error) {
+	size := p.opts.TitleMin
+	lo, hi := int(math.Ceil(p.opts.TitleMin)), int(math.Floor(p.opts.TitleMax))
+
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		if err := p.setFont(p.titleFont(float64(mid))); err != nil {
+			return 0, err
+		}
+
+		if p.fits(title, width, height) {
+			size = float64(mid)
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return size, nil
+}
+
+// fits reports whether the text wrapped with the current font face fits the box of the given width and height
+// without breaking words in between grapheme clusters.
+func (p *Preview) fits(text richText, width, height float64) bool {
+	lines, broken := p.wrapLines(text, width, p.opts.MaxLines)
+
+	if broken || (p.opts.MaxLines > 0 && len(lines) > p.opts.MaxLines) {
+		return false
+	}
+
+	// sync with drawLines, plus descent of the last line
+	metrics := p.face.Metrics()
+	lineH := float64(metrics.Height) / 64
+	spacing := p.titleLineHeight()
+	textH := float64(len(lines))*lineH*spacing - (spacing-1)*lineH + float64(metrics.Descent)/64
+
+	return textH <= height
+}
+
+func (p *Preview) drawLogo(ctx context.Context, logoBuf []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "preview.drawLogo")
+
+	defer func() { tracing.End(span, err) }()
+
+	startedAt := time.Now()
+	logoBuf, err = scale(ctx, logoBuf, p.opts.LogoH)
 
 	if err != nil {
 		return fmt.Errorf("could not resize the logo: %w", err)
 	}
 
+	p.report.timing("resize", logoKey, startedAt)
+
 	logoImg, _, err := image.Decode(bytes.NewReader(logoBuf))
 
 	if err != nil {
 		return fmt.Errorf("could not decode the logo: %w", err)
 	}
 
+	p.report.resized(logoKey, logoImg.Bounds())
+
 	logoX := p.opts.CanvasW - padding - logoImg.Bounds().Dx()
 	logoY := p.opts.CanvasH - padding - p.opts.LogoH
 
 	p.ctx.DrawImage(logoImg, logoX, logoY)
 
+	p.logo = logoImg.Bounds().Sub(logoImg.Bounds().Min).Add(image.Pt(logoX, logoY))
+
 	return nil
 }
 
 // resize resizes an image to the specified width and height if it differs from them.
 // In case the aspect ratio of the source image differs from w/h parameters, it crops it to the area of interest.
-func resize(buf []byte, w, h int) ([]byte, error) {
+func resize(ctx context.Context, buf []byte, w, h int) (_ []byte, err error) {
 	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
 
 	if err != nil {
@@ -287,7 +829,14 @@ func resize(buf []byte, w, h int) ([]byte, error) {
 		return buf, nil
 	}
 
-	log.Printf("Resizing an image to %dx%d px", w, h)
+	startedAt := time.Now()
+	ctx, span := tracing.Start(
+		ctx, "vips.Thumbnail",
+		attribute.String("from", fmt.Sprintf("%dx%d", config.Width, config.Height)),
+		attribute.String("to", fmt.Sprintf("%dx%d", w, h)),
+	)
+
+	defer func() { tracing.End(span, err) }()
 
 	vipsImg, err := vips.NewImageFromBuffer(buf)
 
@@ -307,11 +856,18 @@ func resize(buf []byte, w, h int) ([]byte, error) {
 		return nil, err
 	}
 
+	slog.InfoContext(
+		ctx, "resized an image",
+		"from", fmt.Sprintf("%dx%d", config.Width, config.Height),
+		"to", fmt.Sprintf("%dx%d", w, h),
+		"took", time.Since(startedAt),
+	)
+
 	return buf, nil
 }
 
 // scale resizes an image to the specified height if it differs. Width of the image is auto.
-func scale(buf []byte, h int) ([]byte, error) {
+func scale(ctx context.Context, buf []byte, h int) (_ []byte, err error) {
 	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
 
 	if err != nil {
@@ -322,7 +878,14 @@ func scale(buf []byte, h int) ([]byte, error) {
 		return buf, nil
 	}
 
-	log.Printf("Scaling an image to %dpx height", h)
+	startedAt := time.Now()
+	ctx, span := tracing.Start(
+		ctx, "vips.Resize",
+		attribute.String("from", fmt.Sprintf("%dx%d", config.Width, config.Height)),
+		attribute.Int("to_height", h),
+	)
+
+	defer func() { tracing.End(span, err) }()
 
 	vipsImg, err := vips.NewImageFromBuffer(buf)
 
@@ -342,28 +905,12 @@ func scale(buf []byte, h int) ([]byte, error) {
 		return nil, err
 	}
 
-	return buf, nil
-}
-
-// circle crops circle out of a rectangle source image.
-func circle(src image.Image) image.Image {
-	log.Printf("Circling an image")
-
-	r := int(math.Min(
-		float64(src.Bounds().Dx()),
-		float64(src.Bounds().Dy()),
-	) / 2)
-
-	p := image.Point{
-		X: src.Bounds().Dx() / 2,
-		Y: src.Bounds().Dy() / 2,
-	}
-
-	mask := gg.NewContextForRGBA(image.NewRGBA(src.Bounds()))
-
-	mask.DrawCircle(float64(p.X), float64(p.Y), float64(r))
-	mask.Clip()
-	mask.DrawImage(src, 0, 0)
+	slog.InfoContext(
+		ctx, "scaled an image",
+		"from", fmt.Sprintf("%dx%d", config.Width, config.Height),
+		"to_height", h,
+		"took", time.Since(startedAt),
+	)
 
-	return mask.Image()
+	return buf, nil
 }
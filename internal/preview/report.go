@@ -0,0 +1,142 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// Report describes how a preview was drawn.
+type Report struct {
+	// Effective options the preview was drawn with
+	Options Options `json:"options"`
+	// Assets by their keys (logo, avatar, bg)
+	Assets map[string]*AssetReport `json:"assets"`
+	Title  *TextReport             `json:"title,omitempty"`
+	Author *TextReport             `json:"author,omitempty"`
+	// The subtitle, it has no lines when it was dropped
+	Subtitle *TextReport `json:"subtitle,omitempty"`
+	// The metadata line followed by the tags that were drawn
+	Meta *TextReport `json:"meta,omitempty"`
+	// Characters of the title and the author none of their fonts has a glyph for
+	MissingGlyphs []MissingGlyph `json:"missingGlyphs,omitempty"`
+	// Dominant colors of the background image or the logo used for the tint or the background
+	Palette []Swatch `json:"palette,omitempty"`
+	// Contrast of the text elements with the background in the auto contrast mode
+	Contrast *ContrastReport `json:"contrast,omitempty"`
+	// Durations of the drawing stages in the order they happened
+	Timings []Timing `json:"timings"`
+}
+
+// AssetReport describes an image asset used in the preview.
+type AssetReport struct {
+	URL    string `json:"url"`
+	Bytes  int    `json:"bytes"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Size of the asset after resizing, nil if it was used as is
+	ResizedTo *Size `json:"resizedTo,omitempty"`
+	// Focal point of the crop at the faces found in the asset
+	Focus *Focus `json:"focus,omitempty"`
+}
+
+// Size is a size of an image in pixels.
+type Size struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// TextReport describes a text element of the preview.
+type TextReport struct {
+	// The text as it was drawn (after truncation)
+	Text string `json:"text"`
+	// Lines the text was wrapped to
+	Lines     []string `json:"lines"`
+	Truncated bool     `json:"truncated"`
+	// Runs of characters drawn with the same font of the fallback chain
+	Runs []GlyphRun `json:"runs"`
+	// Parts of the text with their inline styles when the text has markup
+	Spans []StyledSpan `json:"spans,omitempty"`
+}
+
+// StyledSpan is a part of a text drawn with the same inline styles: bold, highlight or code.
+type StyledSpan struct {
+	Text   string   `json:"text"`
+	Styles []string `json:"styles"`
+}
+
+// GlyphRun is a run of characters drawn with the same font.
+type GlyphRun struct {
+	Text string `json:"text"`
+	Font string `json:"font"`
+}
+
+// MissingGlyph is a character of a text element drawn as a blank box since none of the fonts has a glyph for it.
+type MissingGlyph struct {
+	// title, author, subtitle or meta
+	Element   string `json:"element"`
+	Char      string `json:"char"`
+	Codepoint string `json:"codepoint"`
+}
+
+// MissingGlyphsError is returned in the strict glyphs mode when some characters can't be drawn.
+type MissingGlyphsError struct {
+	Glyphs []MissingGlyph
+}
+
+func (e *MissingGlyphsError) Error() string {
+	glyphs := make([]string, 0, len(e.Glyphs))
+
+	for _, g := range e.Glyphs {
+		glyphs = append(glyphs, fmt.Sprintf("%s (%s)", g.Codepoint, g.Element))
+	}
+
+	return "no glyphs for " + strings.Join(glyphs, ", ")
+}
+
+// ContrastReport describes the theme and the overlay opacity picked to meet the target contrast ratio.
+type ContrastReport struct {
+	Target float64 `json:"target"`
+	// dark (white text over a black overlay) or light (black text over a white overlay)
+	Theme   string  `json:"theme"`
+	Opacity float64 `json:"opacity"`
+	// The lowest contrast ratio of the text elements, it's below the target when it can't be met
+	Ratio    float64           `json:"ratio"`
+	Elements []ElementContrast `json:"elements"`
+}
+
+// ElementContrast is the contrast ratio of a text element with the background under it.
+type ElementContrast struct {
+	// title or author
+	Element string `json:"element"`
+	// Relative luminance of the darkest and the lightest background under the element except for a few outliers
+	Dark  float64 `json:"dark"`
+	Light float64 `json:"light"`
+	Ratio float64 `json:"ratio"`
+}
+
+// Timing is a duration of a drawing stage.
+type Timing struct {
+	// Stage name, e.g. fetch or resize
+	Name string `json:"name"`
+	// What the stage worked on, e.g. an asset key
+	Desc string        `json:"desc,omitempty"`
+	Took time.Duration `json:"took"`
+}
+
+// timing adds the duration of a stage started at startedAt to the report.
+func (r *Report) timing(name, desc string, startedAt time.Time) {
+	r.Timings = append(r.Timings, Timing{Name: name, Desc: desc, Took: time.Since(startedAt)})
+}
+
+// resized records the size of the asset as it was drawn if it differs from the original one.
+func (r *Report) resized(key string, bounds image.Rectangle) {
+	asset, ok := r.Assets[key]
+
+	if !ok || (asset.Width == bounds.Dx() && asset.Height == bounds.Dy()) {
+		return
+	}
+
+	asset.ResizedTo = &Size{Width: bounds.Dx(), Height: bounds.Dy()}
+}
@@ -0,0 +1,454 @@
+package preview
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sync"
+	"unicode"
+
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/shaping"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// shaperFontCache is the number of fonts prepared for shaping kept by each shaper
+const shaperFontCache = 32
+
+// complexScripts lists the scripts that can't be drawn glyph by glyph: their letters are joined,
+// reordered or combined depending on the neighbours, or they are written from right to left.
+var complexScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko,
+	unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati, unicode.Oriya,
+	unicode.Tamil, unicode.Telugu, unicode.Kannada, unicode.Malayalam, unicode.Sinhala,
+	unicode.Thai, unicode.Lao, unicode.Tibetan, unicode.Myanmar, unicode.Khmer,
+}
+
+// shapers keeps shapers for reuse, they hold caches and aren't safe for concurrent use
+var shapers = sync.Pool{New: func() interface{} { return new(shaper) }}
+
+// shaper shapes text with the fonts of a font chain.
+type shaper struct {
+	chain     []*fontFile
+	faces     map[*fontFile]*font.Face
+	harfbuzz  shaping.HarfbuzzShaper
+	segmenter shaping.Segmenter
+}
+
+// ResolveFace picks the first face having a glyph for the rune in the fallback order or the family one.
+// Letters missing in the family font are looked up in the font packs first.
+func (s *shaper) ResolveFace(r rune) *font.Face {
+	for i, ff := range s.chain {
+		if i == 1 && isLetter(r) {
+			if face := s.face(packFor(r)); face != nil {
+				return face
+			}
+		}
+
+		if face := s.face(ff); face != nil {
+			if _, ok := face.NominalGlyph(r); ok {
+				return face
+			}
+		}
+	}
+
+	if face := s.face(packFor(r)); face != nil {
+		return face
+	}
+
+	return s.face(s.chain[0])
+}
+
+// face returns the shaper's face of the font loading the font on the first use, or nil if it can't be loaded.
+func (s *shaper) face(ff *fontFile) *font.Face {
+	if ff == nil {
+		return nil
+	}
+
+	if face, ok := s.faces[ff]; ok {
+		return face
+	}
+
+	if err := ff.load(); err != nil {
+		s.faces[ff] = nil
+		return nil
+	}
+
+	s.faces[ff] = font.NewFace(ff.ot)
+
+	return s.faces[ff]
+}
+
+// nameOf returns the font file name of the face.
+func (s *shaper) nameOf(face *font.Face) string {
+	for ff, f := range s.faces {
+		if f == face {
+			return ff.name
+		}
+	}
+
+	return s.chain[0].name
+}
+
+// shape splits the text into runs by direction, script and face, shapes them
+// and returns them in the visual order, from left to right.
+func (s *shaper) shape(text string, points float64) []shaping.Output {
+	runes := []rune(text)
+	input := shaping.Input{
+		Text:      runes,
+		RunEnd:    len(runes),
+		Direction: di.DirectionLTR,
+		Size:      fixed.Int26_6(points * 64),
+	}
+
+	rtl := isRTL(text)
+
+	if rtl {
+		input.Direction = di.DirectionRTL
+	}
+
+	inputs := s.segmenter.Split(input, s)
+	runs := make([]shaping.Output, 0, len(inputs))
+	levels := make([]int, 0, len(inputs))
+
+	for _, in := range inputs {
+		runs = append(runs, s.harfbuzz.Shape(in))
+		levels = append(levels, bidiLevel(rtl, in.Direction.Progression() == di.TowardTopLeft))
+	}
+
+	reorder(runs, levels)
+
+	return runs
+}
+
+// loadShaper returns a shaper of the font chain from the pool. The shaper must be put back to the pool after use.
+func loadShaper(chain []*fontFile) *shaper {
+	s := shapers.Get().(*shaper)
+	s.chain = chain
+
+	if s.faces == nil {
+		s.faces = map[*fontFile]*font.Face{}
+		// the cache is empty by default, so the shaper would prepare each font for every run
+		s.harfbuzz.SetFontCacheSize(shaperFontCache)
+	}
+
+	return s
+}
+
+// needsShaping reports whether the text contains letters of complex scripts, right-to-left ones
+// or ones missing in the family font but present in the font packs. Text of the fonts freetype
+// can't parse, of the emboldened ones and with letter spacing is always shaped.
+func (p *Preview) needsShaping(text string) bool {
+	if p.chain.primary.tt == nil || p.bold > 0 || p.tracking != 0 {
+		return true
+	}
+
+	for _, r := range text {
+		if unicode.In(r, complexScripts...) || p.needsPack(r) {
+			return true
+		}
+
+		if props, _ := bidi.LookupRune(r); props.Class() == bidi.R || props.Class() == bidi.AL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRTL reports whether the text is written from right to left judging by its first strong directional character.
+func isRTL(text string) bool {
+	for _, r := range text {
+		props, _ := bidi.LookupRune(r)
+
+		switch props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+
+	return false
+}
+
+// bidiLevel returns the embedding level of a run in the paragraph of the given direction.
+func bidiLevel(rtlParagraph, rtlRun bool) int {
+	switch {
+	case rtlParagraph && rtlRun:
+		return 1
+	case rtlParagraph:
+		return 2
+	case rtlRun:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// reorder puts the runs in the visual order by reversing each sequence of runs
+// at the level or higher, from the highest level down to the first one.
+func reorder(runs []shaping.Output, levels []int) {
+	highest := 0
+
+	for _, level := range levels {
+		if level > highest {
+			highest = level
+		}
+	}
+
+	for level := highest; level >= 1; level-- {
+		for i := 0; i < len(runs); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+
+			j := i
+
+			for j < len(runs) && levels[j] >= level {
+				j++
+			}
+
+			for l, r := i, j-1; l < r; l, r = l+1, r-1 {
+				runs[l], runs[r] = runs[r], runs[l]
+				levels[l], levels[r] = levels[r], levels[l]
+			}
+
+			i = j
+		}
+	}
+
+	for i := range runs {
+		runs[i].VisualIndex = int32(i)
+	}
+}
+
+// emojiClusters maps indexes of runes of the text to the emoji clusters they belong to.
+func emojiClusters(text string) map[int]*segment {
+	clusters := map[int]*segment{}
+	i := 0
+
+	for _, cluster := range graphemes(text) {
+		n := len([]rune(cluster))
+
+		if img, ok := emojiImage(cluster); ok {
+			seg := &segment{text: cluster, emoji: img}
+
+			for j := i; j < i+n; j++ {
+				clusters[j] = seg
+			}
+		}
+
+		i += n
+	}
+
+	return clusters
+}
+
+// placedGlyph is a glyph outline in font units placed on the canvas at the origin.
+type placedGlyph struct {
+	outline     font.GlyphOutline
+	x, y, scale float64
+}
+
+// widthKey identifies a width of a text shaped with a font and letter spacing.
+type widthKey struct {
+	spec     fontSpec
+	tracking float64
+	text     string
+}
+
+// measureShaped returns the width of the shaped text drawn with the current font.
+// Widths are cached for the render since wrapping measures the same text many times.
+func (p *Preview) measureShaped(text string) float64 {
+	key := widthKey{spec: p.spec, tracking: p.tracking, text: text}
+
+	if w, ok := p.widths[key]; ok {
+		return w
+	}
+
+	w := p.layoutShaped(text, 0, 0, false)
+
+	if p.widths == nil {
+		p.widths = map[widthKey]float64{}
+	}
+
+	p.widths[key] = w
+
+	return w
+}
+
+// drawShaped draws the shaped text on the baseline with the current color, and emojis as color images.
+func (p *Preview) drawShaped(text string, x, baseline float64) {
+	p.layoutShaped(text, x, baseline, true)
+}
+
+// layoutShaped lays the shaped glyphs out from left to right, optionally paints them, and returns the width.
+func (p *Preview) layoutShaped(text string, x, baseline float64, paint bool) float64 {
+	s := loadShaper(p.chain.shaping())
+
+	defer shapers.Put(s)
+
+	emojis := emojiClusters(text)
+	drawn := map[*segment]bool{}
+	glyphs := []placedGlyph{}
+	startX := x
+
+	for _, run := range s.shape(text, p.fontSize) {
+		scale := p.fontSize / float64(run.Face.Upem())
+
+		for _, g := range run.Glyphs {
+			if seg, ok := emojis[g.ClusterIndex]; ok {
+				if !drawn[seg] {
+					if paint {
+						p.drawEmoji(seg.emoji, x, baseline)
+					}
+
+					x += p.fontSize * (emojiAdvance + p.tracking)
+					drawn[seg] = true
+				}
+
+				continue
+			}
+
+			if paint {
+				if outline, ok := run.Face.GlyphData(g.GlyphID).(font.GlyphOutline); ok {
+					glyphs = append(glyphs, placedGlyph{
+						outline: outline,
+						x:       x + fixedToFloat(g.XOffset),
+						y:       baseline - fixedToFloat(g.YOffset),
+						scale:   scale,
+					})
+				}
+			}
+
+			x += fixedToFloat(g.XAdvance)
+
+			if g.XAdvance != 0 {
+				x += p.bold + p.fontSize*p.tracking
+			}
+		}
+	}
+
+	if paint {
+		bounds := image.Rect(
+			int(math.Floor(startX-p.fontSize)),
+			int(math.Floor(baseline-p.fontSize*2)),
+			int(math.Ceil(x+p.fontSize)),
+			int(math.Ceil(baseline+p.fontSize)),
+		)
+
+		p.fillGlyphs(glyphs, bounds)
+	}
+
+	return x - startX
+}
+
+// fillGlyphs rasterizes the glyph outlines within the bounds and draws them with the current color
+// through an anti-aliased coverage mask, the same way gg.Context draws strings.
+func (p *Preview) fillGlyphs(glyphs []placedGlyph, bounds image.Rectangle) {
+	dst, ok := p.ctx.Image().(draw.Image)
+
+	if !ok {
+		return
+	}
+
+	if bounds = bounds.Intersect(dst.Bounds()); bounds.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	// emboldened glyphs are filled at several offsets within the stroke width, the coverage of the copies adds up
+	steps := int(math.Ceil(p.bold))
+
+	for step := 0; step <= steps; step++ {
+		dx := 0.0
+
+		if steps > 0 {
+			dx = p.bold * float64(step) / float64(steps)
+		}
+
+		fillOutlines(z, glyphs, bounds.Min, dx)
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	// the same transform gg.Context uses to draw glyph masks, with the translation only
+	s2d := f64.Aff3{1, 0, float64(bounds.Min.X), 0, 1, float64(bounds.Min.Y)}
+
+	xdraw.BiLinear.Transform(dst, s2d, image.NewUniform(p.color), mask.Bounds(), xdraw.Over, &xdraw.Options{SrcMask: mask})
+}
+
+// fillOutlines adds the glyph outlines shifted by dx to the rasterizer with the origin at min.
+func fillOutlines(z *vector.Rasterizer, glyphs []placedGlyph, min image.Point, dx float64) {
+	for _, g := range glyphs {
+		point := func(sp ot.SegmentPoint) (float32, float32) {
+			return float32(g.x + dx + float64(sp.X)*g.scale - float64(min.X)),
+				float32(g.y - float64(sp.Y)*g.scale - float64(min.Y))
+		}
+
+		for i, seg := range g.outline.Segments {
+			switch seg.Op {
+			case ot.SegmentOpMoveTo:
+				if i > 0 {
+					z.ClosePath()
+				}
+
+				z.MoveTo(point(seg.Args[0]))
+			case ot.SegmentOpLineTo:
+				z.LineTo(point(seg.Args[0]))
+			case ot.SegmentOpQuadTo:
+				x1, y1 := point(seg.Args[0])
+				x2, y2 := point(seg.Args[1])
+
+				z.QuadTo(x1, y1, x2, y2)
+			case ot.SegmentOpCubeTo:
+				x1, y1 := point(seg.Args[0])
+				x2, y2 := point(seg.Args[1])
+				x3, y3 := point(seg.Args[2])
+
+				z.CubeTo(x1, y1, x2, y2, x3, y3)
+			}
+		}
+
+		z.ClosePath()
+	}
+}
+
+// shapedGlyphRuns splits the text into runs of characters drawn with the same font of the current font chain or color emojis.
+func (p *Preview) shapedGlyphRuns(text string) ([]GlyphRun, error) {
+	s := loadShaper(p.chain.shaping())
+
+	defer shapers.Put(s)
+
+	runs := []GlyphRun{}
+
+	for _, cluster := range graphemes(text) {
+		name := emojiFont
+
+		if _, ok := emojiImage(cluster); !ok {
+			r := []rune(cluster)[0]
+			name = s.nameOf(s.ResolveFace(r))
+		}
+
+		if len(runs) > 0 && runs[len(runs)-1].Font == name {
+			runs[len(runs)-1].Text += cluster
+		} else {
+			runs = append(runs, GlyphRun{Text: cluster, Font: name})
+		}
+	}
+
+	return runs, nil
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
@@ -0,0 +1,198 @@
+package preview
+
+import (
+	"bytes"
+	"flag"
+	"image/color"
+	"image/png"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+var update = flag.Bool("update", false, "update the expected images")
+
+func TestNeedsShaping(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected bool
+	}{{
+		name:     "latin",
+		text:     "The quick brown fox",
+		expected: false,
+	}, {
+		name:     "cyrillic and emoji",
+		text:     "Съешь же ещё этих булок 🔥",
+		expected: false,
+	}, {
+		name:     "arabic",
+		text:     "مرحبا بالعالم",
+		expected: true,
+	}, {
+		name:     "hebrew",
+		text:     "שלום עולם",
+		expected: true,
+	}, {
+		name:     "devanagari",
+		text:     devanagari,
+		expected: true,
+	}}
+
+	p := newTestPreview(t, 40)
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := p.needsShaping(tt.text); actual != tt.expected {
+				t.Errorf("%q: expected %v, got %v", tt.text, tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected bool
+	}{{
+		name:     "ltr first",
+		text:     "Hello עולם",
+		expected: false,
+	}, {
+		name:     "rtl first",
+		text:     "שלום world",
+		expected: true,
+	}, {
+		name:     "digits before rtl",
+		text:     "123 مرحبا",
+		expected: true,
+	}, {
+		name:     "emoji and digits",
+		text:     "🔥 123",
+		expected: false,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := isRTL(tt.text); actual != tt.expected {
+				t.Errorf("%q: expected %v, got %v", tt.text, tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestShapeVisualOrder(t *testing.T) {
+	s := loadShaper(newTestPreview(t, 40).chain.shaping())
+
+	defer shapers.Put(s)
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{{
+		name:     "ltr",
+		text:     "abc שלום def",
+		expected: []string{"abc ", "שלום", " def"},
+	}, {
+		name:     "rtl",
+		text:     "שלום abc def עולם",
+		expected: []string{" עולם", "abc def", "שלום "},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			runes := []rune(tt.text)
+			actual := []string{}
+
+			for _, run := range s.shape(tt.text, 40) {
+				actual = append(actual, string(runes[run.Runes.Offset:run.Runes.Offset+run.Runes.Count]))
+			}
+
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected runs %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestShapedGlyphRuns(t *testing.T) {
+	runs, err := newTestPreview(t, 40).glyphRuns("Hi مرحبا 🔥")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []GlyphRun{
+		{Text: "Hi ", Font: "Ubuntu-Medium"},
+		{Text: "مرحبا", Font: "NotoSansArabic-Regular"},
+		{Text: " ", Font: "Ubuntu-Medium"},
+		{Text: "🔥", Font: emojiFont},
+	}
+
+	if !reflect.DeepEqual(runs, expected) {
+		t.Errorf("expected runs %+v, got %+v", expected, runs)
+	}
+}
+
+func TestDrawShaped(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{{
+		name:     "arabic",
+		text:     "مرحبا بالعالم! عنوان 123 English",
+		expected: "./testdata/expected/arabic.png",
+	}, {
+		name:     "hindi",
+		text:     "नमस्ते दुनिया! क्षत्रिय श्री हिंदी",
+		expected: "./testdata/expected/hindi.png",
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preview{opts: &Options{}, ctx: gg.NewContext(720, 80)}
+
+			p.ctx.SetColor(color.White)
+			p.ctx.Clear()
+
+			if err := p.setFont(newFontSpec("", 0, "", 40)); err != nil {
+				t.Fatal(err)
+			}
+
+			p.setColor(color.Black)
+
+			if isRTL(tt.text) {
+				p.drawLines([]richText{plain(tt.text)}, 700, 10, 1, titleLineSpacing)
+			} else {
+				p.drawLines([]richText{plain(tt.text)}, 20, 10, 0, titleLineSpacing)
+			}
+
+			buf := new(bytes.Buffer)
+
+			if err := png.Encode(buf, p.ctx.Image()); err != nil {
+				t.Fatal(err)
+			}
+
+			if *update {
+				if err := os.WriteFile(tt.expected, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(tt.expected)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), expected) {
+				t.Error("images are not equal")
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/image/font"
+)
+
+// graphemes splits the text into extended grapheme clusters (user-perceived characters),
+// e.g. a family emoji, a flag or a letter with combining marks.
+func graphemes(text string) []string {
+	clusters := []string{}
+	state := -1
+
+	for text != "" {
+		var cluster string
+
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+// isInvisible reports whether the code point is an invisible part of an emoji sequence:
+// a joiner, a variation selector, a skin tone modifier or a tag.
+func isInvisible(r rune) bool {
+	return r == '\u200d' || r == '\u200c' ||
+		unicode.Is(unicode.Variation_Selector, r) ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) ||
+		(r >= 0xE0020 && r <= 0xE007F)
+}
+
+// visible drops the invisible parts of grapheme clusters (e.g. joiners of emoji sequences).
+// Glyphs are drawn code point by code point, so they would be drawn as boxes or swatches
+// in between the visible parts instead of combining them.
+func visible(text string) string {
+	var b strings.Builder
+
+	for _, cluster := range graphemes(text) {
+		for i, r := range cluster {
+			if i == 0 || !isInvisible(r) {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// segment is a part of a text drawn either with the current font face or as a color emoji image.
+type segment struct {
+	text  string
+	emoji image.Image
+}
+
+// segments splits the text into runs of grapheme clusters drawn with the font face and color emojis.
+func segments(text string) []segment {
+	result := []segment{}
+
+	for _, cluster := range graphemes(text) {
+		if img, ok := emojiImage(cluster); ok {
+			result = append(result, segment{text: cluster, emoji: img})
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1].emoji == nil {
+			result[n-1].text += cluster
+		} else {
+			result = append(result, segment{text: cluster})
+		}
+	}
+
+	return result
+}
+
+// setFont makes a font face of the spec the current one along with its fallback chain.
+// Faces are taken from the pools once per render and put back by releaseFonts.
+// Fonts freetype can't draw only provide the metrics and their text is shaped.
+func (p *Preview) setFont(spec fontSpec) error {
+	chain, err := resolveChain(spec.family, spec.weight, spec.style)
+
+	if err != nil {
+		return fmt.Errorf("could not resolve a font: %w", err)
+	}
+
+	face, ok := p.fonts[spec]
+
+	if !ok {
+		if face, err = loadFont(spec); err != nil {
+			return fmt.Errorf("could not load a font face: %w", err)
+		}
+
+		if p.fonts == nil {
+			p.fonts = map[fontSpec]font.Face{}
+		}
+
+		p.fonts[spec] = face
+	}
+
+	p.ctx.SetFontFace(face)
+	p.face = face
+	p.chain = chain
+	p.spec = spec
+	p.fontSize = spec.size
+	p.bold = 0
+
+	// families without a variant as bold as requested are emboldened
+	if diff := spec.weight - chain.primary.weight; diff >= 200 {
+		p.bold = spec.size * fauxBold * float64(diff) / 100
+	}
+
+	return nil
+}
+
+// releaseFonts puts the font faces taken during the render back to their pools.
+func (p *Preview) releaseFonts() {
+	for spec, face := range p.fonts {
+		releaseFont(spec, face)
+	}
+
+	p.fonts = nil
+}
+
+// setColor sets the current text color.
+func (p *Preview) setColor(c color.Color) {
+	p.ctx.SetColor(c)
+	p.color = c
+}
+
+// measure returns the width of the text drawn with the current font face.
+func (p *Preview) measure(text string) float64 {
+	if p.needsShaping(text) {
+		return p.measureShaped(text)
+	}
+
+	w := 0.0
+
+	for _, seg := range segments(text) {
+		if seg.emoji != nil {
+			w += p.fontSize * emojiAdvance
+			continue
+		}
+
+		segW, _ := p.ctx.MeasureString(visible(seg.text))
+		w += segW
+	}
+
+	return w
+}
+
+// wrap wraps the text to lines of the given width with the current font face and the span styles.
+// Lines are broken at spaces and at hyphenation points of the title language. Words wider than the width
+// are broken in between grapheme clusters. Wrapping stops once there are more than limit lines,
+// since the rest is cut off anyway; a limit of 0 wraps the whole text.
+func (p *Preview) wrap(text richText, width float64, limit int) []richText {
+	lines, _ := p.wrapLines(text, width, limit)
+
+	return lines
+}
+
+// wrapLines wraps the text like wrap does and reports whether some word was broken in between grapheme clusters.
+func (p *Preview) wrapLines(text richText, width float64, limit int) ([]richText, bool) {
+	lines := []richText{}
+	offset := 0
+	broken := false
+	full := func() bool { return limit > 0 && len(lines) > limit }
+
+	for _, paragraph := range strings.Split(text.text, "\n") {
+		if full() {
+			break
+		}
+
+		// the current line is text[start:end], pos is the start of the next field
+		start, end, pos := offset, offset, offset
+
+		for _, field := range fields(paragraph) {
+			if full() {
+				break
+			}
+
+			wordEnd := pos + len(strings.TrimRightFunc(field, unicode.IsSpace))
+			word := text.slice(pos, wordEnd)
+
+			if end > start && p.measureRich(text.slice(start, wordEnd)) > width {
+				if line, rest, ok := p.hyphenateLine(text.slice(start, end), word, 0, width); ok {
+					lines = append(lines, line)
+					start, end = pos+rest, pos+rest
+				} else {
+					lines = append(lines, text.slice(start, end))
+					start, end = pos, pos
+				}
+			}
+
+			for end == start && !full() && p.measureRich(text.slice(start, wordEnd)) > width {
+				if line, rest, ok := p.hyphenateLine(richText{}, word, start-pos, width); ok {
+					lines = append(lines, line)
+					start, end = pos+rest, pos+rest
+
+					continue
+				}
+
+				chunkLimit := 0
+
+				// enough chunks to exceed the limit with the lines before the word
+				if limit > 0 {
+					chunkLimit = limit - len(lines) + 1
+				}
+
+				chunks := p.breakWord(text.slice(start, wordEnd), width, chunkLimit)
+				lines = append(lines, chunks[:len(chunks)-1]...)
+				start = wordEnd - len(chunks[len(chunks)-1].text)
+				broken = broken || len(chunks) > 1
+
+				break
+			}
+
+			pos += len(field)
+			end = pos
+		}
+
+		if end > start && !full() {
+			lines = append(lines, text.slice(start, end))
+		}
+
+		offset += len(paragraph) + 1
+	}
+
+	for i, line := range lines {
+		lines[i] = line.trimSpace()
+	}
+
+	return lines, broken
+}
+
+// breakWord breaks the word to chunks of the given width in between grapheme clusters.
+// Once there are limit chunks, the rest of the word is the last one; a limit of 0 breaks the whole word.
+func (p *Preview) breakWord(word richText, width float64, limit int) []richText {
+	chunks := []richText{}
+	start, end := 0, 0
+
+	for _, cluster := range graphemes(word.text) {
+		if limit > 0 && len(chunks) >= limit {
+			break
+		}
+
+		if end > start && p.measureRich(word.slice(start, end+len(cluster))) > width {
+			chunks = append(chunks, word.slice(start, end))
+			start = end
+		}
+
+		end += len(cluster)
+	}
+
+	return append(chunks, word.slice(start, len(word.text)))
+}
+
+// fields splits the text to words keeping the spaces following each word.
+// Chinese and Japanese text has no spaces, so each ideograph or kana is a word on its own.
+func fields(text string) []string {
+	result := []string{}
+	start, i := 0, 0
+	prev := rune(-1)
+
+	for _, cluster := range graphemes(text) {
+		r, _ := utf8.DecodeRuneInString(cluster)
+
+		if prev >= 0 && canBreak(prev, r) {
+			result = append(result, text[start:i])
+			start = i
+		}
+
+		prev, _ = utf8.DecodeLastRuneInString(cluster)
+		i += len(cluster)
+	}
+
+	return append(result, text[start:])
+}
+
+// Kinsoku shori: characters that must not start or end a line in Chinese and Japanese text
+const (
+	noLineStart = "、。，．,.・：；:;？！?!‼⁇⁈⁉ー〜～…‥）)］]｝}〕〉》」』】〙〗〟’”»ヽヾゝゞ々〻" +
+		"ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ％‰℃"
+	noLineEnd = "（(［[｛{〔〈《「『【〘〖〝‘“«"
+)
+
+// canBreak reports whether a line can be broken in between the characters:
+// after spaces, and around ideographs and kana unless kinsoku rules prohibit it.
+func canBreak(prev, next rune) bool {
+	switch {
+	case unicode.IsSpace(next):
+		return false
+	case unicode.IsSpace(prev):
+		return true
+	case strings.ContainsRune(noLineStart, next), strings.ContainsRune(noLineEnd, prev):
+		return false
+	default:
+		return isCJK(prev) || isCJK(next)
+	}
+}
+
+// isCJK reports whether the rune is a Chinese or Japanese character or punctuation, which are written without spaces.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Bopomofo) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// drawLines draws the lines from the top with the current font face, color and the span styles.
+// Each line is anchored horizontally at x like gg.Context.DrawStringAnchored does: 0 is left, 1 is right.
+func (p *Preview) drawLines(lines []richText, x, y, ax, lineSpacing float64) {
+	for _, line := range lines {
+		p.drawRich(line, x-ax*p.measureRich(line), y+p.ctx.FontHeight())
+		y += p.ctx.FontHeight() * lineSpacing
+	}
+}
+
+// drawText draws the text on the baseline with the current font face and color, and emojis as color images.
+func (p *Preview) drawText(text string, x, baseline float64) {
+	if p.needsShaping(text) {
+		p.drawShaped(text, x, baseline)
+		return
+	}
+
+	for _, seg := range segments(text) {
+		if seg.emoji != nil {
+			p.drawEmoji(seg.emoji, x, baseline)
+			x += p.fontSize * emojiAdvance
+
+			continue
+		}
+
+		text := visible(seg.text)
+		w, _ := p.ctx.MeasureString(text)
+
+		p.ctx.DrawString(text, x, baseline)
+		x += w
+	}
+}
+
+// drawEmoji draws the emoji image scaled to the current font size at the start of its advance.
+func (p *Preview) drawEmoji(img image.Image, x, baseline float64) {
+	size := int(math.Round(p.fontSize * emojiSize))
+	emojiX := x + p.fontSize*(emojiAdvance-emojiSize)/2
+	emojiY := baseline + p.fontSize*emojiDescent - float64(size)
+
+	p.ctx.DrawImage(p.scaledEmoji(img, size), int(math.Round(emojiX)), int(math.Round(emojiY)))
+}
@@ -0,0 +1,227 @@
+package preview
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	family     = "👨‍👩‍👧"
+	flags      = "🇩🇪🇯🇵🇺🇦"
+	devanagari = "नमस्ते दुनिया"
+)
+
+func newTestPreview(t *testing.T, size float64) *Preview {
+	p := &Preview{opts: &Options{}, ctx: gg.NewContext(100, 100)}
+
+	if err := p.setFont(newFontSpec("", 0, "", size)); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// assertClusters checks that the parts, when joined, consist of the same grapheme clusters as the text,
+// i.e. no cluster has been split between the parts.
+func assertClusters(t *testing.T, text string, parts []string) {
+	t.Helper()
+
+	joined := []string{}
+
+	for _, part := range parts {
+		joined = append(joined, graphemes(part)...)
+	}
+
+	if !reflect.DeepEqual(joined, graphemes(text)) {
+		t.Errorf("grapheme clusters are split: %q", parts)
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{{
+		name:     "family",
+		text:     family + family,
+		expected: []string{family, family},
+	}, {
+		name:     "flags",
+		text:     flags,
+		expected: []string{"🇩🇪", "🇯🇵", "🇺🇦"},
+	}, {
+		name:     "skin tone",
+		text:     "👍🏽!",
+		expected: []string{"👍🏽", "!"},
+	}, {
+		name:     "devanagari",
+		text:     "नमस्ते",
+		expected: []string{"न", "म", "स्", "ते"},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := graphemes(tt.text); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("unexpected clusters, expected: %q, actual: %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestVisible(t *testing.T) {
+	expected := "👨👩👧 👍 🇩🇪"
+
+	if actual := visible(family + " 👍🏽 🇩🇪"); actual != expected {
+		t.Errorf("unexpected visible text, expected: %q, actual: %q", expected, actual)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	testCases := []struct {
+		name  string
+		text  string
+		width float64
+	}{{
+		name:  "family",
+		text:  strings.Repeat(family, 5),
+		width: 100,
+	}, {
+		name:  "flags",
+		text:  strings.Repeat(flags, 3),
+		width: 70,
+	}, {
+		name:  "devanagari",
+		text:  strings.Repeat("नमस्ते", 4),
+		width: 60,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPreview(t, 20)
+			lines := texts(p.wrap(plain(tt.text), tt.width, 0))
+
+			if len(lines) < 2 {
+				t.Errorf("the text is expected to be broken: %q", lines)
+			}
+
+			for _, line := range lines {
+				if w := p.measure(line); w > tt.width {
+					t.Errorf("the line is wider than %v: %q (%v)", tt.width, line, w)
+				}
+			}
+
+			assertClusters(t, tt.text, lines)
+		})
+	}
+}
+
+func TestWrap_Limit(t *testing.T) {
+	testCases := []struct {
+		name string
+		text string
+	}{{
+		name: "words",
+		text: strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100),
+	}, {
+		name: "one word",
+		text: strings.Repeat("quick", 500),
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPreview(t, 20)
+			width := 200.0
+			all := texts(p.wrap(plain(tt.text), width, 0))
+			lines := texts(p.wrap(plain(tt.text), width, 2))
+
+			if len(lines) != 3 {
+				t.Fatalf("expected the wrapping to stop at 3 lines, got %d", len(lines))
+			}
+
+			if !reflect.DeepEqual(lines[:2], all[:2]) {
+				t.Errorf("expected the first lines %q, got %q", all[:2], lines[:2])
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	testCases := []struct {
+		name string
+		text string
+	}{{
+		name: "family",
+		text: strings.Repeat(family, 20),
+	}, {
+		name: "flags",
+		text: strings.Repeat(flags, 10),
+	}, {
+		name: "devanagari",
+		text: strings.Repeat(devanagari, 5),
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPreview(t, 20)
+			p.opts.MaxLines = 1
+			width := 200.0
+			rich, truncated := p.truncate(p.wrap(plain(tt.text), width, 0), width)
+			lines := texts(rich)
+
+			if !truncated || len(lines) != 1 || !strings.HasSuffix(lines[0], ellipsis) {
+				t.Fatalf("the text is expected to be truncated to one line: %q", lines)
+			}
+
+			if w := p.measure(lines[0]); w > width {
+				t.Errorf("the line is wider than %v: %q (%v)", width, lines[0], w)
+			}
+
+			kept := strings.TrimSuffix(lines[0], ellipsis)
+			clusters := graphemes(kept)
+
+			if !reflect.DeepEqual(clusters, graphemes(tt.text)[:len(clusters)]) {
+				t.Errorf("grapheme clusters are split: %q", kept)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{{
+		name:     "spaces",
+		text:     "The quick  brown fox",
+		expected: []string{"The ", "quick  ", "brown ", "fox"},
+	}, {
+		name:     "ideographs",
+		text:     "中文标题",
+		expected: []string{"中", "文", "标", "题"},
+	}, {
+		name:     "mixed",
+		text:     "Go 語言",
+		expected: []string{"Go ", "語", "言"},
+	}, {
+		name:     "no line start",
+		text:     "東京は、ちょっと。",
+		expected: []string{"東", "京", "は、", "ちょっ", "と。"},
+	}, {
+		name:     "no line end",
+		text:     "新しい「デジタル」",
+		expected: []string{"新", "し", "い", "「デ", "ジ", "タ", "ル」"},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := fields(tt.text); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
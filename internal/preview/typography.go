@@ -0,0 +1,411 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Align is a horizontal alignment of a text in its box.
+type Align string
+
+// Alignments, the zero value aligns a text to the start of its direction: left, or right for right-to-left text
+const (
+	AlignAuto   Align = ""
+	AlignLeft   Align = "left"
+	AlignCenter Align = "center"
+	AlignRight  Align = "right"
+)
+
+const (
+	// shadowColor is the default text shadow color, 50% black
+	shadowColor = "#00000080"
+	// strokeColor is the default text outline color
+	strokeColor = "#000000"
+	// blurPasses is the number of box blur passes approximating the gaussian one
+	blurPasses = 3
+)
+
+var errInvalidColor = errors.New("invalid color")
+
+// Typography defines how a text element is drawn. Zero values keep the defaults of the element.
+type Typography struct {
+	// Text color in HEX with an optional alpha: #RGB, #RRGGBB or #RRGGBBAA
+	Color string `json:"color"`
+	Align Align  `json:"align"`
+	// Line height relative to the font height, only the title has several lines
+	LineHeight float64 `json:"lineHeight"`
+	// Letter spacing relative to the font size
+	Tracking  float64 `json:"tracking"`
+	Uppercase bool    `json:"uppercase"`
+	Shadow    *Shadow `json:"shadow,omitempty"`
+	Stroke    *Stroke `json:"stroke,omitempty"`
+}
+
+// Shadow is a text shadow with the offset and the blur radius in pixels.
+type Shadow struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Blur  float64 `json:"blur"`
+	Color string  `json:"color"`
+}
+
+// Stroke is a text outline of the width in pixels.
+type Stroke struct {
+	Width float64 `json:"width"`
+	Color string  `json:"color"`
+}
+
+// ParseAlign parses a text alignment: left, center or right.
+func ParseAlign(s string) (Align, error) {
+	switch a := Align(strings.ToLower(s)); a {
+	case AlignLeft, AlignCenter, AlignRight:
+		return a, nil
+	default:
+		return AlignAuto, fmt.Errorf("unknown alignment %q", s)
+	}
+}
+
+// ParseColor parses a HEX color with an optional alpha: #RGB, #RRGGBB or #RRGGBBAA.
+func ParseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	if len(hex) != 8 || !strings.HasPrefix(s, "#") {
+		return nil, errInvalidColor
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+
+	if err != nil {
+		return nil, errInvalidColor
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// ParseShadow parses a text shadow: "x,y", "x,y,blur" or "x,y,blur,color".
+func ParseShadow(s string) (*Shadow, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, fmt.Errorf("expected x,y[,blur[,color]], got %q", s)
+	}
+
+	nums := make([]float64, 3)
+
+	for i := 0; i < len(parts) && i < 3; i++ {
+		v, err := ParseFinite(strings.TrimSpace(parts[i]))
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %q: %w", parts[i], err)
+		}
+
+		nums[i] = v
+	}
+
+	shadow := &Shadow{X: nums[0], Y: nums[1], Blur: nums[2], Color: shadowColor}
+
+	if len(parts) == 4 {
+		shadow.Color = strings.TrimSpace(parts[3])
+	}
+
+	if _, err := ParseColor(shadow.Color); err != nil || shadow.Blur < 0 {
+		return nil, fmt.Errorf("invalid shadow %q", s)
+	}
+
+	return shadow, nil
+}
+
+// ParseStroke parses a text outline: "width" or "width,color".
+func ParseStroke(s string) (*Stroke, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("expected width[,color], got %q", s)
+	}
+
+	width, err := ParseFinite(strings.TrimSpace(parts[0]))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %q: %w", parts[0], err)
+	}
+
+	stroke := &Stroke{Width: width, Color: strokeColor}
+
+	if len(parts) == 2 {
+		stroke.Color = strings.TrimSpace(parts[1])
+	}
+
+	if _, err := ParseColor(stroke.Color); err != nil || stroke.Width <= 0 {
+		return nil, fmt.Errorf("invalid stroke %q", s)
+	}
+
+	return stroke, nil
+}
+
+// ParseFinite parses a float like strconv.ParseFloat does but rejects NaN and infinities.
+func ParseFinite(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+
+	return v, nil
+}
+
+// anchor returns the x of the box the text is anchored at and the anchor: 0 is left, 0.5 is center, 1 is right.
+func (a Align) anchor(left, right float64, rtl bool) (float64, float64) {
+	switch {
+	case a == AlignCenter:
+		return (left + right) / 2, 0.5
+	case a == AlignRight, a == AlignAuto && rtl:
+		return right, 1
+	default:
+		return left, 0
+	}
+}
+
+// textColor returns the text color of the typography or the default one.
+func (t Typography) textColor(def color.Color) color.Color {
+	if c, err := ParseColor(t.Color); err == nil {
+		return c
+	}
+
+	return def
+}
+
+// transform applies the case transform of the typography to each span of the rich text with the language rules.
+func (t Typography) transform(rt richText, lang string) richText {
+	if !t.Uppercase {
+		return rt
+	}
+
+	upper := cases.Upper(language.Make(lang))
+	b := strings.Builder{}
+	marks := make([]markup, 0, len(rt.marks))
+
+	for _, s := range rt.spans() {
+		text := upper.String(s.text)
+		b.WriteString(text)
+
+		for i := 0; i < len(text); i++ {
+			marks = append(marks, s.mark)
+		}
+	}
+
+	return richText{text: b.String(), marks: marks}
+}
+
+// setTypography makes the letter spacing of the typography the current one.
+func (p *Preview) setTypography(t Typography) {
+	p.tracking = t.Tracking
+}
+
+// drawEffects draws the shadow and the outline of the text draw paints, then the text itself.
+// Both are drawn through the coverage mask of the text: the outline one is dilated by the stroke width
+// and the shadow one is the blurred mask of the outlined text.
+func (p *Preview) drawEffects(t Typography, paint func()) {
+	if t.Shadow == nil && t.Stroke == nil {
+		paint()
+		return
+	}
+
+	mask := p.textMask(paint)
+
+	if t.Stroke != nil {
+		mask = dilate(mask, t.Stroke.Width)
+	}
+
+	if t.Shadow != nil {
+		shadow := blur(mask, t.Shadow.Blur)
+		c, _ := ParseColor(t.Shadow.Color)
+
+		p.fillMask(shadow, c, image.Pt(int(math.Round(t.Shadow.X)), int(math.Round(t.Shadow.Y))))
+	}
+
+	if t.Stroke != nil {
+		c, _ := ParseColor(t.Stroke.Color)
+
+		p.fillMask(mask, c, image.Point{})
+	}
+
+	paint()
+}
+
+// textMask paints the text on a transparent layer of the canvas size and returns its coverage.
+func (p *Preview) textMask(paint func()) *image.Alpha {
+	canvas := p.ctx
+	p.ctx = gg.NewContext(canvas.Width(), canvas.Height())
+
+	p.ctx.SetFontFace(p.face)
+	p.ctx.SetColor(p.color)
+
+	paint()
+
+	layer := p.ctx.Image()
+	p.ctx = canvas
+	mask := image.NewAlpha(layer.Bounds())
+
+	draw.Draw(mask, mask.Bounds(), layer, image.Point{}, draw.Src)
+
+	return mask
+}
+
+// fillMask fills the canvas with the color through the mask shifted by the offset.
+func (p *Preview) fillMask(mask *image.Alpha, c color.Color, offset image.Point) {
+	dst, ok := p.ctx.Image().(draw.Image)
+
+	if !ok {
+		return
+	}
+
+	r := mask.Bounds().Add(offset)
+
+	draw.DrawMask(dst, r, image.NewUniform(c), image.Point{}, mask, mask.Bounds().Min, draw.Over)
+}
+
+// opaqueBounds returns the bounds of the non-transparent part of the mask.
+func opaqueBounds(mask *image.Alpha) image.Rectangle {
+	b := mask.Bounds()
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X, b.Min.Y
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if mask.Pix[mask.PixOffset(x, y)] != 0 {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x+1), max(maxY, y+1)
+			}
+		}
+	}
+
+	if minX >= maxX {
+		return image.Rectangle{}
+	}
+
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// dilate grows the mask by the radius: each pixel takes the max coverage of the points of two circles around it,
+// of the radius and a half of it, which is close to a round pen for the widths of text outlines.
+func dilate(mask *image.Alpha, radius float64) *image.Alpha {
+	b := mask.Bounds()
+	area := opaqueBounds(mask).Inset(-int(math.Ceil(radius))).Intersect(b)
+	result := image.NewAlpha(b)
+
+	copy(result.Pix, mask.Pix)
+
+	for _, r := range []float64{radius, radius / 2} {
+		// the points are about a pixel apart
+		n := int(math.Max(8, math.Ceil(2*math.Pi*r)))
+
+		for i := 0; i < n; i++ {
+			angle := 2 * math.Pi * float64(i) / float64(n)
+			dx, dy := int(math.Round(r*math.Cos(angle))), int(math.Round(r*math.Sin(angle)))
+
+			for y := area.Min.Y; y < area.Max.Y; y++ {
+				sy := y - dy
+
+				if sy < b.Min.Y || sy >= b.Max.Y {
+					continue
+				}
+
+				for x := area.Min.X; x < area.Max.X; x++ {
+					sx := x - dx
+
+					if sx < b.Min.X || sx >= b.Max.X {
+						continue
+					}
+
+					if a := mask.Pix[mask.PixOffset(sx, sy)]; a > result.Pix[result.PixOffset(x, y)] {
+						result.Pix[result.PixOffset(x, y)] = a
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// blur blurs the mask with several box blur passes, which is close to the gaussian blur of the radius.
+func blur(mask *image.Alpha, radius float64) *image.Alpha {
+	// the box of each pass is a third of the radius, so the passes spread the coverage by the radius
+	box := int(math.Round(radius / blurPasses))
+	result := image.NewAlpha(mask.Bounds())
+
+	copy(result.Pix, mask.Pix)
+
+	if box < 1 {
+		return result
+	}
+
+	area := opaqueBounds(mask).Inset(-int(math.Ceil(radius)) - 1).Intersect(mask.Bounds())
+
+	for i := 0; i < blurPasses; i++ {
+		boxBlur(result, area, box, 1, 0)
+		boxBlur(result, area, box, 0, 1)
+	}
+
+	return result
+}
+
+// boxBlur averages each pixel of the area with the ones within the radius in the direction, horizontal or vertical.
+func boxBlur(mask *image.Alpha, area image.Rectangle, radius, dx, dy int) {
+	lines, length := area.Dy(), area.Dx()
+
+	if dy != 0 {
+		lines, length = area.Dx(), area.Dy()
+	}
+
+	line := make([]int, length)
+	width := 2*radius + 1
+
+	for l := 0; l < lines; l++ {
+		at := func(i int) *uint8 {
+			return &mask.Pix[mask.PixOffset(area.Min.X+l*dy+i*dx, area.Min.Y+l*dx+i*dy)]
+		}
+
+		for i := range line {
+			line[i] = int(*at(i))
+		}
+
+		sum := 0
+
+		// a sliding window sum, pixels outside the area are transparent
+		for i := -radius; i < length; i++ {
+			if i+radius < length {
+				sum += line[i+radius]
+			}
+
+			if i-radius-1 >= 0 {
+				sum -= line[i-radius-1]
+			}
+
+			if i >= 0 {
+				*at(i) = uint8(sum / width)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package preview
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected color.Color
+	}{{
+		name:     "short",
+		s:        "#FFF",
+		expected: color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+	}, {
+		name:     "mixed case",
+		s:        "#1a2B3c",
+		expected: color.NRGBA{R: 26, G: 43, B: 60, A: 255},
+	}, {
+		name:     "alpha",
+		s:        "#00000080",
+		expected: color.NRGBA{A: 128},
+	}, {
+		name:     "no hash",
+		s:        "FFF",
+		expected: nil,
+	}, {
+		name:     "four digits",
+		s:        "#FFFF",
+		expected: nil,
+	}, {
+		name:     "not hex",
+		s:        "#GGGGGG",
+		expected: nil,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := ParseColor(tt.s)
+
+			if actual != tt.expected || (err == nil) != (tt.expected != nil) {
+				t.Errorf("%q: expected %v, got %v (%v)", tt.s, tt.expected, actual, err)
+			}
+		})
+	}
+}
+
+func TestParseShadow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected *Shadow
+	}{{
+		name:     "offset",
+		s:        "2,3",
+		expected: &Shadow{X: 2, Y: 3, Color: shadowColor},
+	}, {
+		name:     "blur",
+		s:        "0, -4, 8",
+		expected: &Shadow{Y: -4, Blur: 8, Color: shadowColor},
+	}, {
+		name:     "color",
+		s:        "1,1,2,#E03131",
+		expected: &Shadow{X: 1, Y: 1, Blur: 2, Color: "#E03131"},
+	}, {
+		name:     "offset only x",
+		s:        "1",
+		expected: nil,
+	}, {
+		name:     "negative blur",
+		s:        "1,1,-2",
+		expected: nil,
+	}, {
+		name:     "color name",
+		s:        "1,1,2,red",
+		expected: nil,
+	}, {
+		name:     "NaN offset",
+		s:        "NaN,1",
+		expected: nil,
+	}, {
+		name:     "infinite offset",
+		s:        "1,Inf",
+		expected: nil,
+	}, {
+		name:     "NaN blur",
+		s:        "1,1,NaN",
+		expected: nil,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := ParseShadow(tt.s)
+
+			if !reflect.DeepEqual(actual, tt.expected) || (err == nil) != (tt.expected != nil) {
+				t.Errorf("%q: expected %+v, got %+v (%v)", tt.s, tt.expected, actual, err)
+			}
+		})
+	}
+
+	if s, err := ParseStroke("3,#FFF"); err != nil || *s != (Stroke{Width: 3, Color: "#FFF"}) {
+		t.Errorf("unexpected stroke %+v (%v)", s, err)
+	}
+
+	if _, err := ParseStroke("0"); err == nil {
+		t.Error("expected an error for a stroke of zero width")
+	}
+
+	if _, err := ParseStroke("NaN"); err == nil {
+		t.Error("expected an error for a stroke of NaN width")
+	}
+}
+
+func TestAlign_Anchor(t *testing.T) {
+	testCases := []struct {
+		name  string
+		align Align
+		rtl   bool
+		x, ax float64
+	}{{
+		name:  "left to right text starts at the left",
+		align: AlignAuto,
+		rtl:   false,
+		x:     10,
+		ax:    0,
+	}, {
+		name:  "right to left text starts at the right",
+		align: AlignAuto,
+		rtl:   true,
+		x:     110,
+		ax:    1,
+	}, {
+		name:  "explicit alignment wins",
+		align: AlignLeft,
+		rtl:   true,
+		x:     10,
+		ax:    0,
+	}, {
+		name:  "centered",
+		align: AlignCenter,
+		rtl:   false,
+		x:     60,
+		ax:    0.5,
+	}, {
+		name:  "right",
+		align: AlignRight,
+		rtl:   false,
+		x:     110,
+		ax:    1,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if x, ax := tt.align.anchor(10, 110, tt.rtl); x != tt.x || ax != tt.ax {
+				t.Errorf("expected %v %v, got %v %v", tt.x, tt.ax, x, ax)
+			}
+		})
+	}
+}
+
+func TestDrawTitle_Align(t *testing.T) {
+	p := newMetaPreview(t, Options{
+		Title:           strings.Repeat("Supercalifragilisticexpialidocious", 4),
+		TitleSize:       60,
+		MaxLines:        2,
+		TitleTypography: Typography{Align: AlignRight},
+	})
+
+	if err := p.drawTitle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	left, right := p.textBox()
+
+	if w := p.measureRich(plain(p.report.Title.Lines[0])); w < right-left-p.fontSize {
+		t.Fatalf("expected the first line to take the full width, it's %.0fpx", w)
+	}
+
+	img := p.ctx.Image().(*image.RGBA)
+	bounds := img.Bounds()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.RGBAAt(x, y).A > 0 && (float64(x) < left || float64(x) >= right) {
+				t.Fatalf("expected the title inside %.0f..%.0f, it's drawn at %d,%d", left, right, x, y)
+			}
+		}
+	}
+}
+
+func TestTypography_Transform(t *testing.T) {
+	actual := Typography{Uppercase: true}.transform(parseMarkup("die *Straße* ist ==lang=="), "de")
+	expected := []span{{"DIE ", 0}, {"STRASSE", markBold}, {" IST ", 0}, {"LANG", markHighlight}}
+
+	if !reflect.DeepEqual(actual.spans(), expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual.spans())
+	}
+}
+
+func TestMeasure_Tracking(t *testing.T) {
+	p := newTestPreview(t, 40)
+	text := "Tracking"
+
+	p.setTypography(Typography{Tracking: 0.1})
+
+	width := p.measure(text)
+
+	p.setTypography(Typography{Tracking: 0.2})
+
+	// the spacing is added after each letter
+	if expected, actual := width+8*40*0.1, p.measure(text); math.Abs(actual-expected) > 0.01 {
+		t.Errorf("expected the width %v, got %v", expected, actual)
+	}
+}
+
+func TestDilateBlur(t *testing.T) {
+	mask := image.NewAlpha(image.Rect(0, 0, 100, 100))
+
+	for y := 40; y < 60; y++ {
+		for x := 40; x < 60; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = 255
+		}
+	}
+
+	if actual, expected := opaqueBounds(dilate(mask, 5)), image.Rect(35, 35, 65, 65); actual != expected {
+		t.Errorf("expected the dilated mask bounds %v, got %v", expected, actual)
+	}
+
+	blurred := blur(mask, 9)
+
+	if b := opaqueBounds(blurred); !b.In(image.Rect(30, 30, 70, 70)) || b.Dx() <= 20 {
+		t.Errorf("expected the mask to be spread by the blur radius, got %v", b)
+	}
+
+	if a := blurred.AlphaAt(50, 50).A; a != 255 {
+		t.Errorf("expected the middle of the blurred mask to stay opaque, got %d", a)
+	}
+}
@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/nDmitry/ogimgd/internal/logging"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const bodyLimit = 10 * 1024 * 1024
@@ -19,6 +25,13 @@ const bodyLimit = 10 * 1024 * 1024
 //go:embed images/*
 var images embed.FS
 
+// Resource is a remote resource obtained by GetAll.
+type Resource struct {
+	Buf []byte
+	// How long it took to get the resource
+	Took time.Duration
+}
+
 // Remote can obtain remote resources to use in the preview.
 type Remote struct {
 	httpClient *http.Client
@@ -28,14 +41,27 @@ type Remote struct {
 func New() *Remote {
 	return &Remote{
 		httpClient: &http.Client{
-			Transport: http.DefaultTransport,
+			// propagates W3C trace context to the upstream and traces the request
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
 		},
 	}
 }
 
 // Get fetches a remote resource using an URL or try to read it from the disk when a filename is specified.
 func (r *Remote) Get(ctx context.Context, urlOrPath string) (buf []byte, err error) {
-	log.Printf("getting a resource: %s\n", urlOrPath)
+	startedAt := time.Now()
+	ctx, span := tracing.Start(ctx, "remote.Get", attribute.String("url", urlOrPath))
+
+	slog.DebugContext(ctx, "getting a resource", "url", urlOrPath)
+
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attribute.Int("bytes", len(buf)))
+			slog.InfoContext(ctx, "got a resource", "url", urlOrPath, "bytes", len(buf), "took", time.Since(startedAt))
+		}
+
+		tracing.End(span, err)
+	}()
 
 	_, parseErr := url.ParseRequestURI(urlOrPath)
 
@@ -76,25 +102,30 @@ func (r *Remote) Get(ctx context.Context, urlOrPath string) (buf []byte, err err
 }
 
 // GetAll fetches remote resources concurrently using Get
-func (r *Remote) GetAll(ctx context.Context, urlsOrPaths map[string]string) (map[string][]byte, error) {
-	bufs := make(map[string][]byte, len(urlsOrPaths))
-	errCh := make(chan error)
+func (r *Remote) GetAll(ctx context.Context, urlsOrPaths map[string]string) (map[string]Resource, error) {
+	resources := make(map[string]Resource, len(urlsOrPaths))
+	errCh := make(chan error, len(urlsOrPaths))
 	doneCh := make(chan bool)
+	var mu sync.Mutex
 	var wg sync.WaitGroup
 
 	wg.Add(len(urlsOrPaths))
 
 	for key, urlOrPath := range urlsOrPaths {
 		go func(key string, urlOrPath string) {
-			buf, err := r.Get(ctx, urlOrPath)
+			defer wg.Done()
+
+			startedAt := time.Now()
+			buf, err := r.Get(logging.With(ctx, "asset", key), urlOrPath)
 
 			if err != nil {
 				errCh <- err
+				return
 			}
 
-			bufs[key] = buf
-
-			wg.Done()
+			mu.Lock()
+			resources[key] = Resource{Buf: buf, Took: time.Since(startedAt)}
+			mu.Unlock()
 		}(key, urlOrPath)
 	}
 
@@ -105,9 +136,12 @@ func (r *Remote) GetAll(ctx context.Context, urlsOrPaths map[string]string) (map
 
 	select {
 	case <-doneCh:
-		close(errCh)
-
-		return bufs, nil
+		select {
+		case err := <-errCh:
+			return nil, err
+		default:
+			return resources, nil
+		}
 	case err := <-errCh:
 		return nil, err
 	}
@@ -6,7 +6,19 @@ import (
 )
 
 func handleBadRequest(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadRequest, newErrorResponse(err.Error()))
+}
+
+func handleForbidden(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusForbidden, newErrorResponse(err.Error()))
+}
+
+func handleUnprocessable(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusUnprocessableEntity, newErrorResponse(err.Error()))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
-	json.NewEncoder(w).Encode(newErrorResponse(err.Error()))
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
 }
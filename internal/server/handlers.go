@@ -3,23 +3,131 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"image"
 	"image/jpeg"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nDmitry/ogimgd/internal/preview"
+	"github.com/nDmitry/ogimgd/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-const timeout = 30 * time.Second
+const (
+	timeout      = 30 * time.Second
+	probeTimeout = 5 * time.Second
+	// maxTitleSize is the max font size of titleMin and titleMax
+	maxTitleSize = 200.0
+	// maxTitleLines is the max number of the title lines
+	maxTitleLines = 10
+	// Typography limits
+	maxLineHeight   = 3.0
+	maxTracking     = 1.0
+	maxShadowBlur   = 64.0
+	maxShadowOffset = 64.0
+	maxStrokeWidth  = 16.0
+	// maxOverlayRadius is the max corner radius of the card overlay, half the canvas height
+	maxOverlayRadius = 315.0
+	// maxPaletteSize is the max number of colors of the palette endpoint
+	maxPaletteSize = 16
+	// Subtitle and metadata limits
+	maxSubtitleLines = 5
+	maxReadingTime   = 999
+	maxTags          = 10
+	// Avatar limits
+	minAvaSize   = 16
+	maxAvaSize   = 128
+	maxAvaBorder = 16.0
+)
 
 type drawer interface {
-	Draw(ctx context.Context, opts preview.Options) (image.Image, error)
+	Draw(ctx context.Context, opts preview.Options) (image.Image, *preview.Report, error)
+}
+
+type prober interface {
+	Probe(ctx context.Context) map[string]error
+}
+
+type paletter interface {
+	Palette(ctx context.Context, urlOrPath string, n int) ([]preview.Swatch, error)
 }
 
-func getPreview(d drawer) http.HandlerFunc {
+func getHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, newHealthResponse(statusOK, nil))
+	}
+}
+
+func getReady(p prober, st *state) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if st.isDraining() {
+			writeJSON(w, http.StatusServiceUnavailable, newHealthResponse(statusDraining, nil))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+
+		defer cancel()
+
+		components := make(map[string]componentStatus)
+		code, status := http.StatusOK, statusReady
+
+		for name, err := range p.Probe(ctx) {
+			if err != nil {
+				code, status = http.StatusServiceUnavailable, statusNotReady
+				components[name] = componentStatus{Status: statusError, Message: err.Error()}
+			} else {
+				components[name] = componentStatus{Status: statusOK}
+			}
+		}
+
+		writeJSON(w, code, newHealthResponse(status, components))
+	}
+}
+
+func getPalette(pl paletter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+
+		defer cancel()
+
+		srcParam := r.URL.Query().Get("src")
+
+		if srcParam == "" {
+			handleBadRequest(w, errors.New("Missing required src parameter"))
+			return
+		}
+
+		n := preview.PaletteSize
+
+		if nParam := r.URL.Query().Get("n"); nParam != "" {
+			var err error
+
+			if n, err = strconv.Atoi(nParam); err != nil || n < 1 || n > maxPaletteSize {
+				handleBadRequest(w, errors.New("Could not parse n parameter"))
+				return
+			}
+		}
+
+		colors, err := pl.Palette(ctx, srcParam, n)
+
+		if err != nil {
+			panic(err)
+		}
+
+		writeJSON(w, http.StatusOK, newPaletteResponse(colors))
+	}
+}
+
+func getPreview(d drawer, debugKey string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
@@ -28,15 +136,30 @@ func getPreview(d drawer) http.HandlerFunc {
 		defer cancel()
 
 		opts := preview.Options{
-			CanvasW:    1200,
-			CanvasH:    630,
-			Opacity:    0.6,
-			AvaD:       64,
-			LogoH:      48,
-			TitleSize:  76,
-			AuthorSize: 36,
-			LabelSize:  40,
-			Quality:    84,
+			CanvasW:         1200,
+			CanvasH:         630,
+			Opacity:         0.6,
+			AvaD:            64,
+			Avatar:          preview.Avatar{Border: preview.AvaBorder},
+			Overlay:         preview.Overlay{Angle: preview.OverlayAngle},
+			LogoH:           48,
+			TitleSize:       76,
+			TitleMin:        40,
+			TitleMax:        120,
+			TitleFont:       preview.DefaultFamily,
+			TitleWeight:     preview.WeightMedium,
+			TitleStyle:      preview.StyleNormal,
+			TitleTypography: preview.Typography{LineHeight: 1.2},
+			MaxLines:        3,
+			SubtitleSize:    36,
+			SubtitleLines:   2,
+			Meta:            preview.Meta{Size: 26},
+			AuthorSize:      36,
+			AuthorFont:      preview.DefaultFamily,
+			AuthorWeight:    preview.WeightMedium,
+			AuthorStyle:     preview.StyleNormal,
+			LabelSize:       40,
+			Quality:         84,
 		}
 
 		titleParam := r.URL.Query().Get("title")
@@ -47,6 +170,12 @@ func getPreview(d drawer) http.HandlerFunc {
 		}
 
 		opts.Title = titleParam
+		opts.Subtitle = r.URL.Query().Get("subtitle")
+
+		if err := parseMeta(r.URL.Query(), &opts); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
 
 		authorParam := r.URL.Query().Get("author")
 
@@ -56,20 +185,70 @@ func getPreview(d drawer) http.HandlerFunc {
 			opts.AvaD = 0
 		}
 
+		// repeated author and ava parameters are the authors of a co-authored post paired by their order
+		if authorParams := r.URL.Query()["author"]; len(authorParams) > 1 {
+			if len(authorParams) > preview.MaxAuthors {
+				handleBadRequest(w, errors.New("Too many author parameters"))
+				return
+			}
+
+			avaParams := r.URL.Query()["ava"]
+
+			for i, name := range authorParams {
+				if name == "" {
+					handleBadRequest(w, errors.New("Could not parse author parameter"))
+					return
+				}
+
+				author := preview.Author{Name: name}
+
+				if i < len(avaParams) {
+					author.AvaURL, author.AvaGenerator = parseAva(avaParams[i])
+				}
+
+				opts.Authors = append(opts.Authors, author)
+			}
+		}
+
 		bgParam := r.URL.Query().Get("bg")
 
 		if bgParam != "" {
 			opts.Bg = bgParam
 		}
 
+		if err := parseBackground(r.URL.Query(), &opts.Background); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		bgPaletteParam := r.URL.Query().Get("bgPalette")
+
+		if bgPaletteParam != "" {
+			var err error
+
+			if opts.BgPalette, err = preview.ParseBgPalette(bgPaletteParam); err != nil {
+				handleBadRequest(w, errors.New("Could not parse bgPalette parameter"))
+				return
+			}
+		}
+
 		avaParam := r.URL.Query().Get("ava")
 
 		if avaParam != "" {
-			opts.AvaURL = avaParam
-		} else {
+			opts.AvaURL, opts.AvaGenerator = parseAva(avaParam)
+		} else if len(opts.Authors) == 0 {
 			opts.AuthorSize = 0
 		}
 
+		if avaParam != "" || len(opts.Authors) > 0 {
+			opts.AvaFaces = r.URL.Query().Get("avaFaces") != "0"
+
+			if err := parseAvatar(r.URL.Query(), &opts); err != nil {
+				handleBadRequest(w, err)
+				return
+			}
+		}
+
 		logoParam := r.URL.Query().Get("logo")
 
 		if logoParam == "" {
@@ -84,24 +263,173 @@ func getPreview(d drawer) http.HandlerFunc {
 		if opacityParam != "" {
 			var err error
 
-			if opts.Opacity, err = strconv.ParseFloat(opacityParam, 64); err != nil {
+			if opts.Opacity, err = preview.ParseFinite(opacityParam); err != nil || opts.Opacity < 0 || opts.Opacity > 1 {
 				handleBadRequest(w, errors.New("Could not parse op parameter"))
 				return
 			}
 		}
 
-		img, err := d.Draw(ctx, opts)
+		if err := parseOverlay(r.URL.Query(), &opts.Overlay); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		opts.Tint = r.URL.Query().Get("tint") == "1"
+
+		contrastParam := r.URL.Query().Get("contrast")
+
+		if contrastParam == "auto" {
+			opts.Contrast = preview.ContrastAA
+		} else if contrastParam != "" {
+			var err error
+
+			if opts.Contrast, err = preview.ParseFinite(contrastParam); err != nil || opts.Contrast < 1 || opts.Contrast > preview.MaxContrast {
+				handleBadRequest(w, errors.New("Could not parse contrast parameter"))
+				return
+			}
+		}
+
+		opts.TitleFit = r.URL.Query().Get("titleFit") == "1"
+
+		titleMinParam := r.URL.Query().Get("titleMin")
+
+		if titleMinParam != "" {
+			var err error
+
+			if opts.TitleMin, err = preview.ParseFinite(titleMinParam); err != nil || opts.TitleMin <= 0 || opts.TitleMin > maxTitleSize {
+				handleBadRequest(w, errors.New("Could not parse titleMin parameter"))
+				return
+			}
+		}
+
+		titleMaxParam := r.URL.Query().Get("titleMax")
+
+		if titleMaxParam != "" {
+			var err error
+
+			if opts.TitleMax, err = preview.ParseFinite(titleMaxParam); err != nil || opts.TitleMax <= 0 || opts.TitleMax > maxTitleSize {
+				handleBadRequest(w, errors.New("Could not parse titleMax parameter"))
+				return
+			}
+		}
+
+		// the range is checked against the defaults as well
+		if opts.TitleMin > opts.TitleMax {
+			if titleMaxParam != "" {
+				handleBadRequest(w, errors.New("Could not parse titleMax parameter"))
+			} else {
+				handleBadRequest(w, errors.New("Could not parse titleMin parameter"))
+			}
+
+			return
+		}
+
+		opts.TitleBalance = r.URL.Query().Get("titleBalance") == "1"
+
+		langParam := r.URL.Query().Get("lang")
+
+		if langParam != "" {
+			var err error
+
+			if opts.Lang, err = preview.ParseLang(langParam); err != nil {
+				handleBadRequest(w, errors.New("Could not parse lang parameter"))
+				return
+			}
+		}
+
+		maxLinesParam := r.URL.Query().Get("maxLines")
+
+		if maxLinesParam != "" {
+			var err error
+
+			if opts.MaxLines, err = strconv.Atoi(maxLinesParam); err != nil || opts.MaxLines < 1 || opts.MaxLines > maxTitleLines {
+				handleBadRequest(w, errors.New("Could not parse maxLines parameter"))
+				return
+			}
+		}
+
+		if err := parseFont(r.URL.Query(), "title", &opts.TitleFont, &opts.TitleWeight, &opts.TitleStyle); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		if err := parseFont(r.URL.Query(), "author", &opts.AuthorFont, &opts.AuthorWeight, &opts.AuthorStyle); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		if err := parseTypography(r.URL.Query(), "title", &opts.TitleTypography); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		if err := parseTypography(r.URL.Query(), "author", &opts.AuthorTypography); err != nil {
+			handleBadRequest(w, err)
+			return
+		}
+
+		titleLineHeightParam := r.URL.Query().Get("titleLineHeight")
+
+		if titleLineHeightParam != "" {
+			lineHeight, err := preview.ParseFinite(titleLineHeightParam)
+
+			if err != nil || lineHeight <= 0 || lineHeight > maxLineHeight {
+				handleBadRequest(w, errors.New("Could not parse titleLineHeight parameter"))
+				return
+			}
+
+			opts.TitleTypography.LineHeight = lineHeight
+		}
+
+		opts.StrictGlyphs = r.URL.Query().Get("strictGlyphs") == "1"
+
+		debug := r.URL.Query().Get("debug") == "1"
+
+		if debug && !isDebugKeyValid(debugKey, r.URL.Query().Get("debugKey")) {
+			handleForbidden(w, errors.New("Debug mode requires a valid debugKey parameter"))
+			return
+		}
+
+		img, report, err := d.Draw(ctx, opts)
+
+		if report != nil && len(report.MissingGlyphs) > 0 {
+			w.Header().Set("X-Missing-Glyphs", missingGlyphs(report.MissingGlyphs))
+		}
+
+		var missingErr *preview.MissingGlyphsError
+
+		if errors.As(err, &missingErr) {
+			handleUnprocessable(w, fmt.Errorf("Some characters have no glyphs in the fonts: %s", missingGlyphs(missingErr.Glyphs)))
+			return
+		}
 
 		if err != nil {
 			panic(err)
 		}
 
+		startedAt := time.Now()
+		_, span := tracing.Start(ctx, "jpeg.Encode", attribute.Int("quality", opts.Quality))
 		buf := new(bytes.Buffer)
 
-		if err = jpeg.Encode(buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: opts.Quality})
+
+		tracing.End(span, err)
+
+		if err != nil {
 			panic(err)
 		}
 
+		slog.InfoContext(ctx, "encoded a preview", "bytes", buf.Len(), "took", time.Since(startedAt))
+
+		report.Timings = append(report.Timings, preview.Timing{Name: "encode", Took: time.Since(startedAt)})
+
+		w.Header().Set("Server-Timing", serverTiming(report.Timings))
+
+		if debug {
+			writeJSON(w, http.StatusOK, newDebugResponse(report, buf.Len()))
+			return
+		}
+
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.Header().Set("Content-Length", strconv.Itoa(len(buf.Bytes())))
 
@@ -110,3 +438,318 @@ func getPreview(d drawer) http.HandlerFunc {
 		}
 	}
 }
+
+// parseFont parses the font family, weight and style parameters of the element, e.g. titleFont, titleWeight and titleStyle.
+// Missing parameters keep the values.
+func parseFont(query url.Values, element string, family *string, weight *preview.Weight, style *preview.Style) error {
+	if familyParam := query.Get(element + "Font"); familyParam != "" {
+		if !preview.HasFamily(familyParam) {
+			return fmt.Errorf("Unknown font family in %sFont parameter", element)
+		}
+
+		*family = familyParam
+	}
+
+	if weightParam := query.Get(element + "Weight"); weightParam != "" {
+		var err error
+
+		if *weight, err = preview.ParseWeight(weightParam); err != nil {
+			return fmt.Errorf("Could not parse %sWeight parameter", element)
+		}
+	}
+
+	if styleParam := query.Get(element + "Style"); styleParam != "" {
+		var err error
+
+		if *style, err = preview.ParseStyle(styleParam); err != nil {
+			return fmt.Errorf("Could not parse %sStyle parameter", element)
+		}
+	}
+
+	return nil
+}
+
+// parseTypography parses the typography parameters of the element, e.g. titleColor, titleAlign, titleTracking,
+// titleUppercase, titleShadow and titleStroke. Missing parameters keep the values.
+func parseTypography(query url.Values, element string, typo *preview.Typography) error {
+	if colorParam := query.Get(element + "Color"); colorParam != "" {
+		if _, err := preview.ParseColor(colorParam); err != nil {
+			return fmt.Errorf("Could not parse %sColor parameter", element)
+		}
+
+		typo.Color = colorParam
+	}
+
+	if alignParam := query.Get(element + "Align"); alignParam != "" {
+		var err error
+
+		if typo.Align, err = preview.ParseAlign(alignParam); err != nil {
+			return fmt.Errorf("Could not parse %sAlign parameter", element)
+		}
+	}
+
+	if trackingParam := query.Get(element + "Tracking"); trackingParam != "" {
+		var err error
+
+		if typo.Tracking, err = preview.ParseFinite(trackingParam); err != nil || math.Abs(typo.Tracking) > maxTracking {
+			return fmt.Errorf("Could not parse %sTracking parameter", element)
+		}
+	}
+
+	typo.Uppercase = query.Get(element+"Uppercase") == "1"
+
+	if shadowParam := query.Get(element + "Shadow"); shadowParam != "" {
+		var err error
+
+		if typo.Shadow, err = preview.ParseShadow(shadowParam); err != nil || !isShadowValid(typo.Shadow) {
+			return fmt.Errorf("Could not parse %sShadow parameter", element)
+		}
+	}
+
+	if strokeParam := query.Get(element + "Stroke"); strokeParam != "" {
+		var err error
+
+		if typo.Stroke, err = preview.ParseStroke(strokeParam); err != nil || typo.Stroke.Width > maxStrokeWidth {
+			return fmt.Errorf("Could not parse %sStroke parameter", element)
+		}
+	}
+
+	return nil
+}
+
+// parseBackground parses the background image parameters: bgFit, bgFocus, bgFaces, bgBlur, bgGrayscale,
+// bgDuotone and bgBrightness. Missing parameters keep the values.
+func parseBackground(query url.Values, bg *preview.Background) error {
+	if fitParam := query.Get("bgFit"); fitParam != "" {
+		var err error
+
+		if bg.Fit, err = preview.ParseFit(fitParam); err != nil {
+			return errors.New("Could not parse bgFit parameter")
+		}
+	}
+
+	if focusParam := query.Get("bgFocus"); focusParam != "" {
+		var err error
+
+		if bg.Focus, err = preview.ParseFocus(focusParam); err != nil {
+			return errors.New("Could not parse bgFocus parameter")
+		}
+	}
+
+	if blurParam := query.Get("bgBlur"); blurParam != "" {
+		var err error
+
+		if bg.Blur, err = preview.ParseFinite(blurParam); err != nil || bg.Blur < 0 || bg.Blur > preview.MaxBgBlur {
+			return errors.New("Could not parse bgBlur parameter")
+		}
+	}
+
+	bg.Faces = query.Get("bgFaces") == "1"
+	bg.Grayscale = query.Get("bgGrayscale") == "1"
+
+	if duotoneParam := query.Get("bgDuotone"); duotoneParam != "" {
+		var err error
+
+		if bg.Duotone, err = preview.ParseDuotone(duotoneParam); err != nil {
+			return errors.New("Could not parse bgDuotone parameter")
+		}
+	}
+
+	if brightnessParam := query.Get("bgBrightness"); brightnessParam != "" {
+		var err error
+
+		if bg.Brightness, err = preview.ParseFinite(brightnessParam); err != nil || bg.Brightness <= 0 || bg.Brightness > preview.MaxBgBrightness {
+			return errors.New("Could not parse bgBrightness parameter")
+		}
+	}
+
+	return nil
+}
+
+// parseMeta parses the subtitle lines and the metadata parameters: subtitleLines, date, readingTime, category
+// and tags. Missing parameters keep the values.
+func parseMeta(query url.Values, opts *preview.Options) error {
+	if linesParam := query.Get("subtitleLines"); linesParam != "" {
+		var err error
+
+		if opts.SubtitleLines, err = strconv.Atoi(linesParam); err != nil || opts.SubtitleLines < 1 || opts.SubtitleLines > maxSubtitleLines {
+			return errors.New("Could not parse subtitleLines parameter")
+		}
+	}
+
+	if dateParam := query.Get("date"); dateParam != "" {
+		var err error
+
+		if opts.Meta.Date, err = time.Parse(time.DateOnly, dateParam); err != nil {
+			return errors.New("Could not parse date parameter")
+		}
+	}
+
+	if readingTimeParam := query.Get("readingTime"); readingTimeParam != "" {
+		var err error
+
+		if opts.Meta.ReadingTime, err = strconv.Atoi(readingTimeParam); err != nil || opts.Meta.ReadingTime < 1 || opts.Meta.ReadingTime > maxReadingTime {
+			return errors.New("Could not parse readingTime parameter")
+		}
+	}
+
+	opts.Meta.Category = query.Get("category")
+
+	if tagsParam := query.Get("tags"); tagsParam != "" {
+		for _, tag := range strings.Split(tagsParam, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				opts.Meta.Tags = append(opts.Meta.Tags, tag)
+			}
+		}
+
+		if len(opts.Meta.Tags) > maxTags {
+			return errors.New("Could not parse tags parameter")
+		}
+	}
+
+	return nil
+}
+
+// parseAva parses an avatar parameter: a generator name or an URL of the avatar image.
+func parseAva(param string) (string, preview.AvaGenerator) {
+	switch gen := preview.AvaGenerator(param); gen {
+	case preview.AvaInitials, preview.AvaIdenticon:
+		return "", gen
+	default:
+		return param, preview.AvaFetched
+	}
+}
+
+// parseAvatar parses the avatar parameters: avaSize, avaShape, avaBorder, avaBorderColor and avaShadow.
+// Missing parameters keep the values.
+func parseAvatar(query url.Values, opts *preview.Options) error {
+	if sizeParam := query.Get("avaSize"); sizeParam != "" {
+		var err error
+
+		if opts.AvaD, err = strconv.Atoi(sizeParam); err != nil || opts.AvaD < minAvaSize || opts.AvaD > maxAvaSize {
+			return errors.New("Could not parse avaSize parameter")
+		}
+	}
+
+	if shapeParam := query.Get("avaShape"); shapeParam != "" {
+		var err error
+
+		if opts.Avatar.Shape, err = preview.ParseAvaShape(shapeParam); err != nil {
+			return errors.New("Could not parse avaShape parameter")
+		}
+	}
+
+	if borderParam := query.Get("avaBorder"); borderParam != "" {
+		var err error
+
+		if opts.Avatar.Border, err = preview.ParseFinite(borderParam); err != nil || opts.Avatar.Border < 0 || opts.Avatar.Border > maxAvaBorder {
+			return errors.New("Could not parse avaBorder parameter")
+		}
+	}
+
+	if colorParam := query.Get("avaBorderColor"); colorParam != "" {
+		if _, err := preview.ParseColor(colorParam); err != nil {
+			return errors.New("Could not parse avaBorderColor parameter")
+		}
+
+		opts.Avatar.BorderColor = colorParam
+	}
+
+	if shadowParam := query.Get("avaShadow"); shadowParam != "" {
+		var err error
+
+		if opts.Avatar.Shadow, err = preview.ParseShadow(shadowParam); err != nil || !isShadowValid(opts.Avatar.Shadow) {
+			return errors.New("Could not parse avaShadow parameter")
+		}
+	}
+
+	return nil
+}
+
+// parseOverlay parses the overlay parameters: overlay, overlayFill, overlayColor, overlayRadius and overlayAngle.
+// Missing parameters keep the values.
+func parseOverlay(query url.Values, overlay *preview.Overlay) error {
+	if shapeParam := query.Get("overlay"); shapeParam != "" {
+		var err error
+
+		if overlay.Shape, err = preview.ParseOverlayShape(shapeParam); err != nil {
+			return errors.New("Could not parse overlay parameter")
+		}
+	}
+
+	if fillParam := query.Get("overlayFill"); fillParam != "" {
+		var err error
+
+		if overlay.Fill, err = preview.ParseOverlayFill(fillParam); err != nil {
+			return errors.New("Could not parse overlayFill parameter")
+		}
+	}
+
+	if colorParam := query.Get("overlayColor"); colorParam != "" {
+		if _, err := preview.ParseColor(colorParam); err != nil {
+			return errors.New("Could not parse overlayColor parameter")
+		}
+
+		overlay.Color = colorParam
+	}
+
+	if radiusParam := query.Get("overlayRadius"); radiusParam != "" {
+		var err error
+
+		if overlay.Radius, err = preview.ParseFinite(radiusParam); err != nil || overlay.Radius < 0 || overlay.Radius > maxOverlayRadius {
+			return errors.New("Could not parse overlayRadius parameter")
+		}
+	}
+
+	if angleParam := query.Get("overlayAngle"); angleParam != "" {
+		var err error
+
+		if overlay.Angle, err = preview.ParseFinite(angleParam); err != nil {
+			return errors.New("Could not parse overlayAngle parameter")
+		}
+	}
+
+	return nil
+}
+
+// isShadowValid reports whether the shadow offset and blur are within the limits.
+func isShadowValid(shadow *preview.Shadow) bool {
+	return math.Abs(shadow.X) <= maxShadowOffset && math.Abs(shadow.Y) <= maxShadowOffset && shadow.Blur <= maxShadowBlur
+}
+
+// isDebugKeyValid reports whether the debug mode is enabled and the key matches the configured one.
+func isDebugKeyValid(debugKey, key string) bool {
+	return debugKey != "" && subtle.ConstantTimeCompare([]byte(debugKey), []byte(key)) == 1
+}
+
+// missingGlyphs formats the unique code points of the missing glyphs as a comma separated list.
+func missingGlyphs(glyphs []preview.MissingGlyph) string {
+	codepoints := make([]string, 0, len(glyphs))
+	seen := map[string]bool{}
+
+	for _, g := range glyphs {
+		if !seen[g.Codepoint] {
+			codepoints = append(codepoints, g.Codepoint)
+			seen[g.Codepoint] = true
+		}
+	}
+
+	return strings.Join(codepoints, ", ")
+}
+
+// serverTiming formats the timings as a Server-Timing header value. There's no cache stage since previews aren't cached.
+func serverTiming(timings []preview.Timing) string {
+	metrics := make([]string, 0, len(timings))
+
+	for _, t := range timings {
+		metric := t.Name
+
+		if t.Desc != "" {
+			metric += fmt.Sprintf(";desc=%q", t.Desc)
+		}
+
+		metrics = append(metrics, metric+fmt.Sprintf(";dur=%.2f", float64(t.Took)/float64(time.Millisecond)))
+	}
+
+	return strings.Join(metrics, ", ")
+}
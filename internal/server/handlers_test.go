@@ -2,18 +2,25 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/nDmitry/ogimgd/internal/preview"
 )
 
+const testDebugKey = "secret"
+
 func TestGetPreviewHandler_Success(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		file, err := os.ReadFile("./testdata/bg.jpg")
@@ -29,7 +36,7 @@ func TestGetPreviewHandler_Success(t *testing.T) {
 	defer ts.Close()
 
 	p := preview.New()
-	handler := getPreview(p)
+	handler := getPreview(p, testDebugKey)
 
 	testCases := []struct {
 		name     string
@@ -86,7 +93,7 @@ func TestGetPreviewHandler_Success(t *testing.T) {
 
 func TestGetPreviewHandler_Bad(t *testing.T) {
 	p := preview.New()
-	handler := getPreview(p)
+	handler := getPreview(p, testDebugKey)
 
 	testCases := []struct {
 		name     string
@@ -104,6 +111,218 @@ func TestGetPreviewHandler_Bad(t *testing.T) {
 		name:     "opacity",
 		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&ava=avatar.png&logo=logo.png&op=bad",
 		expected: "Could not parse op parameter",
+	}, {
+		name:     "NaN opacity",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&ava=avatar.png&logo=logo.png&op=NaN",
+		expected: "Could not parse op parameter",
+	}, {
+		name:     "opacity out of range",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&ava=avatar.png&logo=logo.png&op=1.5",
+		expected: "Could not parse op parameter",
+	}, {
+		name:     "title min",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMin=-1",
+		expected: "Could not parse titleMin parameter",
+	}, {
+		name:     "title max",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMin=50&titleMax=40",
+		expected: "Could not parse titleMax parameter",
+	}, {
+		name:     "title min too large",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMin=4000",
+		expected: "Could not parse titleMin parameter",
+	}, {
+		name:     "title min NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMin=NaN",
+		expected: "Could not parse titleMin parameter",
+	}, {
+		name:     "title min above default max",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMin=150",
+		expected: "Could not parse titleMin parameter",
+	}, {
+		name:     "title max too large",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMax=4000",
+		expected: "Could not parse titleMax parameter",
+	}, {
+		name:     "title max infinite",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMax=Inf",
+		expected: "Could not parse titleMax parameter",
+	}, {
+		name:     "title max below default min",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFit=1&titleMax=30",
+		expected: "Could not parse titleMax parameter",
+	}, {
+		name:     "max lines",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&maxLines=0",
+		expected: "Could not parse maxLines parameter",
+	}, {
+		name:     "too many lines",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&maxLines=11",
+		expected: "Could not parse maxLines parameter",
+	}, {
+		name:     "title font",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleFont=Comic%20Sans",
+		expected: "Unknown font family in titleFont parameter",
+	}, {
+		name:     "title weight",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleWeight=heavy",
+		expected: "Could not parse titleWeight parameter",
+	}, {
+		name:     "author style",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorStyle=oblique",
+		expected: "Could not parse authorStyle parameter",
+	}, {
+		name:     "title color",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleColor=white",
+		expected: "Could not parse titleColor parameter",
+	}, {
+		name:     "title align",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleAlign=justify",
+		expected: "Could not parse titleAlign parameter",
+	}, {
+		name:     "title line height",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleLineHeight=0",
+		expected: "Could not parse titleLineHeight parameter",
+	}, {
+		name:     "title line height NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleLineHeight=NaN",
+		expected: "Could not parse titleLineHeight parameter",
+	}, {
+		name:     "title tracking NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleTracking=NaN",
+		expected: "Could not parse titleTracking parameter",
+	}, {
+		name:     "overlay",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&overlay=circle",
+		expected: "Could not parse overlay parameter",
+	}, {
+		name:     "overlay fill",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&overlayFill=conic",
+		expected: "Could not parse overlayFill parameter",
+	}, {
+		name:     "overlay color",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&overlayColor=blue",
+		expected: "Could not parse overlayColor parameter",
+	}, {
+		name:     "overlay radius",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&overlay=card&overlayRadius=1e9",
+		expected: "Could not parse overlayRadius parameter",
+	}, {
+		name:     "subtitle lines",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&subtitle=Foo&subtitleLines=0",
+		expected: "Could not parse subtitleLines parameter",
+	}, {
+		name:     "date",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&date=01.05.2024",
+		expected: "Could not parse date parameter",
+	}, {
+		name:     "reading time",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&readingTime=-5",
+		expected: "Could not parse readingTime parameter",
+	}, {
+		name:     "tags",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&tags=a,b,c,d,e,f,g,h,i,j,k",
+		expected: "Could not parse tags parameter",
+	}, {
+		name:     "empty co-author",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=Alice&author=",
+		expected: "Could not parse author parameter",
+	}, {
+		name:     "ava size",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaSize=512",
+		expected: "Could not parse avaSize parameter",
+	}, {
+		name:     "ava shape",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaShape=star",
+		expected: "Could not parse avaShape parameter",
+	}, {
+		name:     "ava border",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaBorder=-1",
+		expected: "Could not parse avaBorder parameter",
+	}, {
+		name:     "ava border NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaBorder=NaN",
+		expected: "Could not parse avaBorder parameter",
+	}, {
+		name:     "ava shadow",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaShadow=0,4,100",
+		expected: "Could not parse avaShadow parameter",
+	}, {
+		name:     "ava shadow offset",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&author=%40DmitryNikitenko&ava=avatar.png&avaShadow=1e300,4",
+		expected: "Could not parse avaShadow parameter",
+	}, {
+		name:     "bg fit",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgFit=stretch",
+		expected: "Could not parse bgFit parameter",
+	}, {
+		name:     "bg focus",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgFocus=0.5,1.5",
+		expected: "Could not parse bgFocus parameter",
+	}, {
+		name:     "bg duotone",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgDuotone=%23000",
+		expected: "Could not parse bgDuotone parameter",
+	}, {
+		name:     "bg brightness",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgBrightness=0",
+		expected: "Could not parse bgBrightness parameter",
+	}, {
+		name:     "bg blur NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgBlur=NaN",
+		expected: "Could not parse bgBlur parameter",
+	}, {
+		name:     "bg brightness NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgBrightness=NaN",
+		expected: "Could not parse bgBrightness parameter",
+	}, {
+		name:     "bg palette",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&bgPalette=rainbow",
+		expected: "Could not parse bgPalette parameter",
+	}, {
+		name:     "contrast",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&contrast=22",
+		expected: "Could not parse contrast parameter",
+	}, {
+		name:     "contrast NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&contrast=NaN",
+		expected: "Could not parse contrast parameter",
+	}, {
+		name:     "lang",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&lang=!!",
+		expected: "Could not parse lang parameter",
+	}, {
+		name:     "author shadow",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorShadow=1,1,1000",
+		expected: "Could not parse authorShadow parameter",
+	}, {
+		name:     "author shadow NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorShadow=NaN,1",
+		expected: "Could not parse authorShadow parameter",
+	}, {
+		name:     "author shadow infinite",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorShadow=1,-Inf",
+		expected: "Could not parse authorShadow parameter",
+	}, {
+		name:     "author shadow huge offset",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorShadow=1e300,1",
+		expected: "Could not parse authorShadow parameter",
+	}, {
+		name:     "title shadow offset",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&logo=logo.png&titleShadow=0,100",
+		expected: "Could not parse titleShadow parameter",
+	}, {
+		name:     "author stroke NaN",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorStroke=NaN",
+		expected: "Could not parse authorStroke parameter",
+	}, {
+		name:     "author stroke",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&logo=logo.png&authorStroke=2,black",
+		expected: "Could not parse authorStroke parameter",
+	}, {
+		name:     "debug key",
+		req:      "/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester&ava=avatar.png&logo=logo.png&debug=1&debugKey=bad",
+		expected: "Debug mode requires a valid debugKey parameter",
 	}}
 
 	for _, tt := range testCases {
@@ -139,9 +358,510 @@ func TestGetPreviewHandler_Bad(t *testing.T) {
 	}
 }
 
+func TestGetPreviewHandler_Debug(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/preview?title=The%20quick%20brown%20fox%20jumps%20over%20the%20lazy%20dog&author=%40Tester%20%F0%9F%94%A5&ava=avatar.png&logo=logo.png&debug=1&debugKey="+testDebugKey,
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	res := w.Result()
+	mes := debugResponse{}
+
+	if err := json.NewDecoder(res.Body).Decode(&mes); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK || mes.Bytes == 0 {
+		t.Errorf("unexpected debug response: %d %d", res.StatusCode, mes.Bytes)
+	}
+
+	for _, metric := range []string{`fetch;desc="logo"`, `resize;desc="avatar"`, "draw;dur=", "encode;dur="} {
+		if !strings.Contains(res.Header.Get("Server-Timing"), metric) {
+			t.Errorf("Server-Timing header doesn't contain %s: %s", metric, res.Header.Get("Server-Timing"))
+		}
+	}
+
+	if mes.Report.Options.Author != "@Tester 🔥" || mes.Report.Assets["logo"].Width != 349 {
+		t.Errorf("unexpected report: %+v", mes.Report)
+	}
+
+	if len(mes.Report.Title.Lines) != 2 || mes.Report.Title.Truncated {
+		t.Errorf("unexpected title report: %+v", mes.Report.Title)
+	}
+
+	expectedRuns := []preview.GlyphRun{{Text: "@Tester ", Font: "Ubuntu-Medium"}, {Text: "🔥", Font: "Twemoji"}}
+
+	if !reflect.DeepEqual(mes.Report.Author.Runs, expectedRuns) {
+		t.Errorf("unexpected author glyph runs: %+v", mes.Report.Author.Runs)
+	}
+}
+
+func TestGetPreviewHandler_Fonts(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/preview?title=Hello&titleFont=go&titleWeight=bold&author=%40Tester&authorFont=Go&authorStyle=italic&logo=logo.png&debug=1&debugKey="+testDebugKey,
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	mes := debugResponse{}
+
+	if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs := mes.Report.Title.Runs; len(runs) != 1 || runs[0].Font != "Go-Bold" {
+		t.Errorf("unexpected title glyph runs: %+v", runs)
+	}
+
+	if runs := mes.Report.Author.Runs; len(runs) != 1 || runs[0].Font != "Go-Medium-Italic" {
+		t.Errorf("unexpected author glyph runs: %+v", runs)
+	}
+}
+
+func TestGetPreviewHandler_Typography(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/preview?title=Hello&titleColor=%23FFD43B&titleAlign=center&titleUppercase=1&titleShadow=2,2,6&author=%40Tester&authorTracking=0.2&authorStroke=2&logo=logo.png&debug=1&debugKey="+testDebugKey,
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	mes := debugResponse{}
+
+	if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+		t.Fatal(err)
+	}
+
+	title := mes.Report.Options.TitleTypography
+
+	if title.Align != preview.AlignCenter || title.LineHeight != 1.2 || title.Shadow == nil || title.Shadow.Blur != 6 {
+		t.Errorf("unexpected title typography: %+v", title)
+	}
+
+	if mes.Report.Title.Text != "HELLO" {
+		t.Errorf("expected the uppercase title, got %q", mes.Report.Title.Text)
+	}
+
+	if author := mes.Report.Options.AuthorTypography; author.Tracking != 0.2 || author.Stroke == nil || author.Stroke.Width != 2 {
+		t.Errorf("unexpected author typography: %+v", author)
+	}
+}
+
+func TestGetPreviewHandler_Contrast(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	testCases := []struct {
+		bg    string
+		theme string
+	}{
+		{bg: "%23FFFFFF", theme: "light"},
+		{bg: "%23111111", theme: "dark"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.theme, func(t *testing.T) {
+			req := httptest.NewRequest(
+				"GET",
+				"/preview?title=Hello&author=%40Tester&logo=logo.png&contrast=auto&bg="+tt.bg+"&debug=1&debugKey="+testDebugKey,
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			mes := debugResponse{}
+
+			if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+				t.Fatal(err)
+			}
+
+			contrast := mes.Report.Contrast
+
+			if contrast == nil || contrast.Theme != tt.theme || contrast.Ratio < preview.ContrastAA {
+				t.Fatalf("unexpected contrast: %+v", contrast)
+			}
+
+			if mes.Report.Options.Opacity != contrast.Opacity {
+				t.Errorf("expected the opacity %v in the options, got %v", contrast.Opacity, mes.Report.Options.Opacity)
+			}
+		})
+	}
+}
+
+func TestGetPreviewHandler_Palette(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/preview?title=Hello&author=%40Tester&ava=avatar.png&logo=avatar.png&tint=1&bgPalette=gradient&debug=1&debugKey="+testDebugKey,
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	mes := debugResponse{}
+
+	if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mes.Report.Palette) != preview.PaletteSize {
+		t.Errorf("expected %d colors of the logo, got %+v", preview.PaletteSize, mes.Report.Palette)
+	}
+}
+
+func TestGetPreviewHandler_MissingGlyphs(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	testCases := []struct {
+		name   string
+		query  string
+		status int
+	}{{
+		name:   "default",
+		query:  "&debug=1&debugKey=" + testDebugKey,
+		status: http.StatusOK,
+	}, {
+		name:   "strict",
+		query:  "&strictGlyphs=1",
+		status: http.StatusUnprocessableEntity,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				"GET",
+				"/preview?title=Ethiopic%20%E1%88%80&author=%40Tester%20%E1%88%80&logo=logo.png"+tt.query,
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			res := w.Result()
+
+			if res.StatusCode != tt.status {
+				t.Errorf("unexpected status code, expected: %d, actual: %d", tt.status, res.StatusCode)
+			}
+
+			if header := res.Header.Get("X-Missing-Glyphs"); header != "U+1200" {
+				t.Errorf("unexpected X-Missing-Glyphs header: %s", header)
+			}
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			mes := debugResponse{}
+
+			if err := json.NewDecoder(res.Body).Decode(&mes); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []preview.MissingGlyph{
+				{Element: "title", Char: "ሀ", Codepoint: "U+1200"},
+				{Element: "author", Char: "ሀ", Codepoint: "U+1200"},
+			}
+
+			if !reflect.DeepEqual(mes.Report.MissingGlyphs, expected) {
+				t.Errorf("unexpected missing glyphs: %+v", mes.Report.MissingGlyphs)
+			}
+		})
+	}
+}
+
+func TestGetPreviewHandler_TitleFit(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	testCases := []struct {
+		name  string
+		title string
+		min   float64
+		max   float64
+	}{{
+		name:  "short",
+		title: "Short",
+		min:   120,
+		max:   120,
+	}, {
+		name:  "long",
+		title: "The quick brown fox jumps over the lazy dog. Sphinx of black quartz, judge my vow. Pack my box",
+		min:   50,
+		max:   75,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				"GET",
+				fmt.Sprintf("/preview?title=%s&author=%%40Tester&ava=avatar.png&logo=logo.png&titleFit=1&debug=1&debugKey=%s", url.QueryEscape(tt.title), testDebugKey),
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			mes := debugResponse{}
+
+			if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+				t.Fatal(err)
+			}
+
+			size := mes.Report.Options.TitleSize
+
+			if size < tt.min || size > tt.max {
+				t.Errorf("unexpected title size, expected: %v-%v, actual: %v", tt.min, tt.max, size)
+			}
+		})
+	}
+}
+
+func TestGetPreviewHandler_MaxLines(t *testing.T) {
+	p := preview.New()
+	handler := getPreview(p, testDebugKey)
+
+	testCases := []struct {
+		name      string
+		title     string
+		maxLines  int
+		lines     []string
+		truncated bool
+	}{{
+		name:     "fits",
+		title:    "The quick brown fox jumps over the lazy dog",
+		maxLines: 2,
+		lines:    []string{"The quick brown fox jumps", "over the lazy dog"},
+	}, {
+		name:      "word boundary",
+		title:     "The quick brown fox jumps over the lazy dog",
+		maxLines:  1,
+		lines:     []string{"The quick brown fox jumps…"},
+		truncated: true,
+	}, {
+		name:      "punctuation",
+		title:     "Инвестиции в зарубежные бумаги, через российских брокеров",
+		maxLines:  1,
+		lines:     []string{"Инвестиции в зарубежные…"},
+		truncated: true,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				"GET",
+				fmt.Sprintf("/preview?title=%s&author=%%40Tester&ava=avatar.png&logo=logo.png&maxLines=%d&debug=1&debugKey=%s", url.QueryEscape(tt.title), tt.maxLines, testDebugKey),
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			mes := debugResponse{}
+
+			if err := json.NewDecoder(w.Result().Body).Decode(&mes); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(mes.Report.Title.Lines, tt.lines) || mes.Report.Title.Truncated != tt.truncated {
+				t.Errorf("unexpected title lines: %q, truncated: %v", mes.Report.Title.Lines, mes.Report.Title.Truncated)
+			}
+		})
+	}
+}
+
+type failingProber struct{}
+
+func (failingProber) Probe(ctx context.Context) map[string]error {
+	return map[string]error{"fonts": nil, "vips": errors.New("vips is broken")}
+}
+
+func TestGetPaletteHandler(t *testing.T) {
+	handler := getPalette(preview.New())
+
+	testCases := []struct {
+		name   string
+		query  string
+		code   int
+		colors int
+	}{{
+		name:   "default",
+		query:  "?src=avatar.png",
+		code:   http.StatusOK,
+		colors: preview.PaletteSize,
+	}, {
+		name:   "size",
+		query:  "?src=avatar.png&n=2",
+		code:   http.StatusOK,
+		colors: 2,
+	}, {
+		name:  "missing src",
+		query: "",
+		code:  http.StatusBadRequest,
+	}, {
+		name:  "bad size",
+		query: "?src=avatar.png&n=100",
+		code:  http.StatusBadRequest,
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			handler(w, httptest.NewRequest("GET", "/palette"+tt.query, nil))
+
+			res := w.Result()
+
+			if res.StatusCode != tt.code {
+				t.Fatalf("expected %d, got %d", tt.code, res.StatusCode)
+			}
+
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			mes := paletteResponse{}
+
+			if err := json.NewDecoder(res.Body).Decode(&mes); err != nil {
+				t.Fatal(err)
+			}
+
+			share := 0.0
+
+			for _, c := range mes.Colors {
+				share += c.Share
+			}
+
+			if len(mes.Colors) != tt.colors || math.Abs(share-1) > 1e-9 {
+				t.Errorf("expected %d colors covering the image, got %+v", tt.colors, mes.Colors)
+			}
+		})
+	}
+}
+
+func TestGetHealthHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	getHealth()(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	res := w.Result()
+	mes := healthResponse{}
+
+	if err := json.NewDecoder(res.Body).Decode(&mes); err != nil {
+		t.Error(err)
+	}
+
+	if res.StatusCode != http.StatusOK || mes.Status != statusOK {
+		t.Errorf("unexpected health status: %d %s", res.StatusCode, mes.Status)
+	}
+}
+
+func TestGetReadyHandler(t *testing.T) {
+	draining := &state{}
+
+	draining.drain()
+
+	testCases := []struct {
+		name       string
+		prober     prober
+		state      *state
+		code       int
+		status     string
+		components map[string]string
+	}{{
+		name:   "ready",
+		prober: preview.New(),
+		state:  &state{},
+		code:   http.StatusOK,
+		status: statusReady,
+		components: map[string]string{
+			"fonts":  statusOK,
+			"assets": statusOK,
+			"vips":   statusOK,
+			"render": statusOK,
+		},
+	}, {
+		name:   "failed component",
+		prober: failingProber{},
+		state:  &state{},
+		code:   http.StatusServiceUnavailable,
+		status: statusNotReady,
+		components: map[string]string{
+			"fonts": statusOK,
+			"vips":  statusError,
+		},
+	}, {
+		name:       "draining",
+		prober:     preview.New(),
+		state:      draining,
+		code:       http.StatusServiceUnavailable,
+		status:     statusDraining,
+		components: map[string]string{},
+	}}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			getReady(tt.prober, tt.state)(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			res := w.Result()
+			mes := healthResponse{}
+
+			if err := json.NewDecoder(res.Body).Decode(&mes); err != nil {
+				t.Error(err)
+			}
+
+			if res.StatusCode != tt.code || mes.Status != tt.status {
+				t.Errorf("unexpected readiness status: %d %s", res.StatusCode, mes.Status)
+			}
+
+			if len(mes.Components) != len(tt.components) {
+				t.Errorf("unexpected components: %v", mes.Components)
+			}
+
+			for name, status := range tt.components {
+				if mes.Components[name].Status != status {
+					t.Errorf("unexpected %s status, expected: %s, actual: %s", name, status, mes.Components[name].Status)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkGetPreviewHandler(b *testing.B) {
 	p := preview.New()
-	handler := getPreview(p)
+	handler := getPreview(p, testDebugKey)
 
 	for n := 0; n < b.N; n++ {
 		req := httptest.NewRequest(
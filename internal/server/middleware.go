@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nDmitry/ogimgd/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestLogger attaches the request and trace IDs to the request context, so every record logged down the
+// pipeline can be tied to the request, and logs each completed request.
+// It has to be installed after middleware.RequestID and the tracing middleware.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		ctx := logging.With(r.Context(), "request_id", middleware.GetReqID(r.Context()))
+
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			ctx = logging.With(ctx, "trace_id", sc.TraceID().String())
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		slog.InfoContext(
+			ctx, "request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"status", ww.Status(),
+			"bytes", ww.BytesWritten(),
+			"took", time.Since(startedAt),
+		)
+	})
+}
@@ -1,6 +1,14 @@
 package server
 
-const statusError = "error"
+import "github.com/nDmitry/ogimgd/internal/preview"
+
+const (
+	statusError    = "error"
+	statusOK       = "ok"
+	statusReady    = "ready"
+	statusNotReady = "not ready"
+	statusDraining = "draining"
+)
 
 // errorResponse is HTTP error request message format
 type errorResponse struct {
@@ -15,3 +23,54 @@ func newErrorResponse(message string) errorResponse {
 		Message: message,
 	}
 }
+
+// componentStatus is a status of a single component of the preview pipeline
+type componentStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// healthResponse is HTTP health and readiness check message format
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components,omitempty"`
+}
+
+// newHealthResponse returns a health check response
+func newHealthResponse(status string, components map[string]componentStatus) healthResponse {
+	return healthResponse{
+		Status:     status,
+		Components: components,
+	}
+}
+
+// paletteResponse is HTTP palette message format
+type paletteResponse struct {
+	Status string           `json:"status"`
+	Colors []preview.Swatch `json:"colors"`
+}
+
+// newPaletteResponse returns a palette response
+func newPaletteResponse(colors []preview.Swatch) paletteResponse {
+	return paletteResponse{
+		Status: statusOK,
+		Colors: colors,
+	}
+}
+
+// debugResponse is HTTP debug mode message format
+type debugResponse struct {
+	Status string          `json:"status"`
+	Report *preview.Report `json:"report"`
+	// Size of the encoded preview
+	Bytes int `json:"bytes"`
+}
+
+// newDebugResponse returns a debug mode response
+func newDebugResponse(report *preview.Report, bytes int) debugResponse {
+	return debugResponse{
+		Status: statusOK,
+		Report: report,
+		Bytes:  bytes,
+	}
+}
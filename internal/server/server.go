@@ -3,7 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -13,21 +13,45 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-// Run starts the HTTP server
-func Run(port int, d drawer) {
+// drainDelay is how long the server keeps serving while reporting not-ready before shutting down,
+// so that load balancers have time to stop routing new requests to it
+const drainDelay = 5 * time.Second
+
+type renderer interface {
+	drawer
+	prober
+	paletter
+}
+
+// Run starts the HTTP server. An empty debugKey disables the debug mode of the preview endpoint.
+func Run(port int, rr renderer, debugKey string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	startedAt := time.Now().UTC()
+	st := &state{}
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(otelhttp.NewMiddleware(
+		"ogimgd",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+		}),
+	))
+	r.Use(requestLogger)
 	r.Use(middleware.Recoverer)
 
-	r.Get("/preview", getPreview(d))
+	r.Get("/preview", getPreview(rr, debugKey))
+	r.Get("/palette", getPalette(rr))
+	r.Get("/healthz", getHealth())
+	r.Get("/readyz", getReady(rr, st))
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(
@@ -45,10 +69,11 @@ func Run(port int, d drawer) {
 	server.RegisterOnShutdown(cancel)
 
 	go func() {
-		log.Printf("HTTP server started on port %d\n", port)
+		slog.Info("HTTP server started", "port", port)
 
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server ListenAndServe: %v", err)
+			slog.Error("HTTP server ListenAndServe", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -62,21 +87,26 @@ func Run(port int, d drawer) {
 	)
 
 	<-signalChan
-	log.Println("os.Interrupt - shutting down...")
+	slog.Info("os.Interrupt - shutting down...")
 
 	go func() {
 		<-signalChan
-		log.Fatalln("os.Kill - terminating...")
+		slog.Error("os.Kill - terminating...")
+		os.Exit(1)
 	}()
 
+	st.drain()
+	slog.Info("draining...", "delay", drainDelay)
+	time.Sleep(drainDelay)
+
 	gracefullCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancelShutdown()
 
 	if err := server.Shutdown(gracefullCtx); err != nil {
-		log.Printf("shutdown error: %v\n", err)
+		slog.Error("shutdown error", "error", err)
 		defer os.Exit(1)
 		return
 	}
 
-	log.Println("gracefully stopped")
+	slog.Info("gracefully stopped")
 }
@@ -0,0 +1,18 @@
+package server
+
+import "sync/atomic"
+
+// state holds the server lifecycle state shared between handlers.
+type state struct {
+	draining int32
+}
+
+// drain marks the server as shutting down, so it stops reporting readiness.
+func (s *state) drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// isDraining reports whether the server is shutting down.
+func (s *state) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetup_Stdout(t *testing.T) {
+	buf := new(bytes.Buffer)
+	shutdown, err := Setup(context.Background(), ExporterStdout, buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+
+	for _, expected := range []string{`"Name":"parent"`, `"Name":"child"`, `"Description":"failed"`, parent.SpanContext().TraceID().String()} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("exported spans don't contain %s", expected)
+		}
+	}
+}
+
+func TestSetup_Bad(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin", new(bytes.Buffer)); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}